@@ -0,0 +1,753 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"gopkg.in/yaml.v3"
+)
+
+// currentFormatVersion is the scenario format this tool writes.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
+
+// scenarioColumns is the column order of CSV rows while converting.
+var scenarioColumns = []string{"path", "op", "message", "content", "author", "target", "repo", "time"}
+
+func main() {
+	input := flag.String("input", "", "Scenario to convert (.csv, .yaml, .yml or .json)")
+	output := flag.String("output", "", "Scenario to write; the format follows the extension")
+	contentDir := flag.String("content-dir", "", "Directory for content that cannot be stored inline in CSV (default: <output>_content)")
+	flag.Parse()
+
+	if *input == "" || *output == "" {
+		log.Fatal("Flags --input and --output are required.")
+	}
+	if *contentDir == "" {
+		*contentDir = strings.TrimSuffix(*output, filepath.Ext(*output)) + "_content"
+	}
+
+	var ops []DocumentOperation
+	var err error
+	if isScenarioDocument(*input) {
+		ops, err = readScenarioDocument(*input)
+	} else {
+		ops, err = csvOperations(*input)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *input, err)
+	}
+	rebaseContentFiles(ops, filepath.Dir(*input), filepath.Dir(*output))
+
+	switch strings.ToLower(filepath.Ext(*output)) {
+	case ".yaml", ".yml":
+		err = writeYAML(*output, ops)
+	case ".json":
+		err = writeJSON(*output, ops)
+	default:
+		err = writeCSV(*output, *contentDir, ops)
+	}
+	if err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+
+	fmt.Printf("%s converted to %s: %d operation(s).\n", *input, *output, len(ops))
+}
+
+// csvOperations reads a CSV scenario of any version into document operations. Version 1
+// updates without content get their "test data" placeholder spelled out, and "@file:"
+// references are kept as content_file next to the loaded content.
+func csvOperations(filename string) ([]DocumentOperation, error) {
+	version, rows, lines, err := readScenarioCSV(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []DocumentOperation
+	for i, row := range rows {
+		op := DocumentOperation{Path: row[0], Op: row[1], Message: row[2], Content: row[3], Author: row[4], Target: row[5], Repo: row[6], Time: row[7], Line: lines[i]}
+		if op.Op == "update" && op.Content == "" && version < 2 {
+			op.Content = "test data"
+		}
+		if strings.HasPrefix(op.Content, "@file:") {
+			op.ContentFile = strings.TrimPrefix(op.Content, "@file:")
+			contentPath := op.ContentFile
+			if !filepath.IsAbs(contentPath) {
+				contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+			}
+			content, err := os.ReadFile(contentPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read content reference at line %d: %v", op.Line, err)
+			}
+			op.Content = string(content)
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// rebaseContentFiles keeps relative content_file references working when the output is
+// written to another directory.
+func rebaseContentFiles(ops []DocumentOperation, fromDir, toDir string) {
+	if filepath.Clean(fromDir) == filepath.Clean(toDir) {
+		return
+	}
+	for i := range ops {
+		ref := ops[i].ContentFile
+		if ref == "" || filepath.IsAbs(ref) {
+			continue
+		}
+		if rel, err := filepath.Rel(toDir, filepath.Join(fromDir, ref)); err == nil {
+			ops[i].ContentFile = filepath.ToSlash(rel)
+		}
+	}
+}
+
+// documentForm returns the operations as they are written to YAML or JSON: text content
+// is inlined, binary content stays behind its content_file reference. Documents expand
+// "${name}", so text that only looks like a placeholder is escaped as "$${name}".
+func documentForm(ops []DocumentOperation) ScenarioDocument {
+	doc := ScenarioDocument{Format: currentFormatVersion}
+	for _, op := range ops {
+		for _, field := range []*string{&op.Path, &op.Op, &op.Message, &op.Content, &op.ContentFile, &op.Author, &op.Target, &op.Repo, &op.Time} {
+			*field = placeholder.ReplaceAllString(*field, "$$$0")
+		}
+		if op.ContentFile != "" && utf8.ValidString(op.Content) && !strings.Contains(op.Content, "\x00") {
+			op.ContentFile = ""
+		}
+		if op.ContentFile != "" {
+			op.Content = ""
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	return doc
+}
+
+func writeYAML(filename string, ops []DocumentOperation) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(documentForm(ops)); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+func writeJSON(filename string, ops []DocumentOperation) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // keep "Name <email>" authors readable
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(documentForm(ops)); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, buf.Bytes(), 0644)
+}
+
+// writeCSV writes the current CSV format. Content that CSV trimming would change is
+// written to contentDir (or kept at its content_file) and referenced with "@file:".
+func writeCSV(filename, contentDir string, ops []DocumentOperation) error {
+	columns := 4
+	for _, op := range ops {
+		for i, value := range []string{op.Author, op.Target, op.Repo, op.Time} {
+			if value != "" && columns < 5+i {
+				columns = 5 + i
+			}
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{fmt.Sprintf("%s %d", formatMarker, currentFormatVersion)})
+	writer.Write(scenarioColumns[:columns])
+	for _, op := range ops {
+		content, err := contentColumn(op, filename, contentDir)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", op.Line, err)
+		}
+		row := []string{op.Path, op.Op, op.Message, content, op.Author, op.Target, op.Repo, op.Time}
+		writer.Write(row[:columns])
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func contentColumn(op DocumentOperation, outputFile, contentDir string) (string, error) {
+	content := op.Content
+	if content == strings.TrimSpace(content) && !strings.Contains(content, "\x00") && !strings.HasPrefix(content, "@file:") {
+		return content, nil
+	}
+	if op.ContentFile != "" {
+		return "@file:" + op.ContentFile, nil
+	}
+
+	if err := os.MkdirAll(contentDir, 0755); err != nil {
+		return "", err
+	}
+	data := []byte(content)
+	blobPath := filepath.Join(contentDir, plumbing.ComputeHash(plumbing.BlobObject, data).String())
+	if err := os.WriteFile(blobPath, data, 0644); err != nil {
+		return "", err
+	}
+
+	// References are resolved relative to the scenario file
+	rel, err := filepath.Rel(filepath.Dir(outputFile), blobPath)
+	if err != nil {
+		rel = blobPath
+	}
+	return "@file:" + filepath.ToSlash(rel), nil
+}
+
+// readScenarioCSV returns the format version and the rows in scenarioColumns order with
+// the line each one starts on. Fields are trimmed the way the executor trims them.
+func readScenarioCSV(filename string) (int, [][]string, []int, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	version := 1
+	var positions []int
+	headerChecked := false
+	var rows [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, nil, fmt.Errorf("CSV parsing error: %v", err)
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		if !headerChecked {
+			if version == 1 {
+				v, isMarker, err := parseFormatMarker(record)
+				if err != nil {
+					return 0, nil, nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				if isMarker {
+					version = v
+					continue
+				}
+			}
+			headerChecked = true
+			var isHeader bool
+			if positions, isHeader, err = parseHeader(record); err != nil {
+				return 0, nil, nil, fmt.Errorf("invalid header at line %d: %v", lineNumber, err)
+			}
+			if isHeader {
+				continue
+			}
+			if version >= 2 {
+				return 0, nil, nil, fmt.Errorf("scenario format %d requires a header row at line %d", version, lineNumber)
+			}
+		}
+		if positions != nil {
+			record = reorderRecord(record, positions)
+		}
+
+		if len(record) < 3 {
+			return 0, nil, nil, fmt.Errorf("invalid row at line %d: expected at least 3 columns, got %d", lineNumber, len(record))
+		}
+		row := make([]string, len(scenarioColumns))
+		for i := range row {
+			if i < len(record) {
+				row[i] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+		lines = append(lines, lineNumber)
+	}
+	return version, rows, lines, nil
+}
+
+// ScenarioDocument is the YAML/JSON form of a scenario. Operations map onto the CSV
+// columns; content is taken verbatim, so multi-line content needs no "@file:" reference.
+// Vars are defaults for "${name}" placeholders and can be overridden by an include.
+type ScenarioDocument struct {
+	Format     int                 `json:"format,omitempty" yaml:"format,omitempty"`
+	Vars       map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Operations []DocumentOperation `json:"operations" yaml:"operations"`
+}
+
+// DocumentOperation is one entry of a ScenarioDocument: an operation, an include of
+// another document, or a for loop over Do. Expansion leaves only operations.
+type DocumentOperation struct {
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	Op          string `json:"op,omitempty" yaml:"op,omitempty"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+	Content     string `json:"content,omitempty" yaml:"content,omitempty"`
+	ContentFile string `json:"content_file,omitempty" yaml:"content_file,omitempty"` // relative to the scenario
+	Author      string `json:"author,omitempty" yaml:"author,omitempty"`
+	Target      string `json:"target,omitempty" yaml:"target,omitempty"`
+	Repo        string `json:"repo,omitempty" yaml:"repo,omitempty"` // repository name or path, for multi-repository runs
+	Time        string `json:"time,omitempty" yaml:"time,omitempty"` // RFC 3339 time of the operation, for time-scaled replay
+
+	Include string              `json:"include,omitempty" yaml:"include,omitempty"` // document to splice in, relative to this one
+	Vars    map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`       // extra variables for the include or loop body
+	For     string              `json:"for,omitempty" yaml:"for,omitempty"`         // loop variable name
+	In      []string            `json:"in,omitempty" yaml:"in,omitempty"`           // values to loop over
+	Range   string              `json:"range,omitempty" yaml:"range,omitempty"`     // or an integer range "first..last"
+	Pad     int                 `json:"pad,omitempty" yaml:"pad,omitempty"`         // zero-pad range values to this width
+	Do      []DocumentOperation `json:"do,omitempty" yaml:"do,omitempty"`
+
+	Line   int    `json:"-" yaml:"-"`
+	Origin string `json:"-" yaml:"-"` // file:line and loop values the operation was expanded from
+}
+
+// placeholder matches "${name}", and "$${name}", which stands for a literal "${name}".
+var placeholder = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isScenarioDocument reports whether the file extension selects the YAML or JSON format.
+func isScenarioDocument(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readScenarioDocument loads a YAML or JSON scenario and expands its includes, loops and
+// variables. Each operation keeps the line it was written on and an Origin naming the
+// file and loop values, and content_file references are read into Content.
+func readScenarioDocument(filename string) ([]DocumentOperation, error) {
+	return expandDocument(filename, nil, "", nil)
+}
+
+func expandDocument(filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, included := range stack {
+		if included == abs {
+			return nil, fmt.Errorf("include cycle: %s is already being expanded", filename)
+		}
+	}
+
+	doc, err := loadScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables passed by an include win over the document's defaults
+	scope := make(map[string]string)
+	for name, value := range doc.Vars {
+		scope[name] = value
+	}
+	for name, value := range vars {
+		scope[name] = value
+	}
+	return expandItems(doc.Operations, filename, scope, bindings, append(stack, abs))
+}
+
+func expandItems(items []DocumentOperation, filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	var ops []DocumentOperation
+	for _, item := range items {
+		where := fmt.Sprintf("%s:%d", filename, item.Line)
+		scope, err := withVars(vars, item.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+
+		switch {
+		case item.Include != "" && item.For != "":
+			return nil, fmt.Errorf("%s: an entry cannot be both an include and a for loop", where)
+		case item.Include != "" || item.For != "":
+			if item.Path != "" || item.Op != "" {
+				return nil, fmt.Errorf("%s: include and for entries cannot also be operations", where)
+			}
+		}
+
+		switch {
+		case item.Include != "":
+			name, err := substitute(item.Include, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(filename), name)
+			}
+			included, err := expandDocument(name, scope, bindings, stack)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			ops = append(ops, included...)
+
+		case item.For != "":
+			values, err := loopValues(item, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			for _, value := range values {
+				body := make(map[string]string, len(scope)+1)
+				for name, v := range scope {
+					body[name] = v
+				}
+				body[item.For] = value
+				expanded, err := expandItems(item.Do, filename, body, fmt.Sprintf("%s %s=%s", bindings, item.For, value), stack)
+				if err != nil {
+					return nil, err
+				}
+				ops = append(ops, expanded...)
+			}
+
+		default:
+			op, err := expandOperation(item, filename, scope, stack[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			op.Origin = where
+			if bindings != "" {
+				op.Origin += " [" + strings.TrimSpace(bindings) + "]"
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// expandOperation fills in the placeholders of one operation and loads its content_file.
+// The content_file reference is rewritten relative to the top-level document.
+func expandOperation(item DocumentOperation, filename string, vars map[string]string, topLevel string) (DocumentOperation, error) {
+	op := DocumentOperation{Line: item.Line}
+	fields := []struct {
+		from string
+		to   *string
+	}{
+		{item.Path, &op.Path}, {item.Op, &op.Op}, {item.Message, &op.Message}, {item.Content, &op.Content},
+		{item.ContentFile, &op.ContentFile}, {item.Author, &op.Author}, {item.Target, &op.Target}, {item.Repo, &op.Repo}, {item.Time, &op.Time},
+	}
+	for _, field := range fields {
+		value, err := substitute(field.from, vars)
+		if err != nil {
+			return op, err
+		}
+		*field.to = value
+	}
+
+	if op.Path == "" || op.Op == "" {
+		return op, fmt.Errorf("operation needs a path and an op")
+	}
+	if op.ContentFile == "" {
+		return op, nil
+	}
+	if op.Content != "" {
+		return op, fmt.Errorf("operation has both content and content_file")
+	}
+	contentPath := op.ContentFile
+	if !filepath.IsAbs(contentPath) {
+		contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+		if abs, err := filepath.Abs(contentPath); err == nil {
+			if rel, err := filepath.Rel(filepath.Dir(topLevel), abs); err == nil {
+				op.ContentFile = filepath.ToSlash(rel)
+			}
+		}
+	}
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		return op, fmt.Errorf("failed to read content_file: %v", err)
+	}
+	op.Content = string(content)
+	return op, nil
+}
+
+// withVars returns vars extended by extra, whose values may use the variables in vars.
+func withVars(vars, extra map[string]string) (map[string]string, error) {
+	if len(extra) == 0 {
+		return vars, nil
+	}
+	scope := make(map[string]string, len(vars)+len(extra))
+	for name, value := range vars {
+		scope[name] = value
+	}
+	for name, value := range extra {
+		expanded, err := substitute(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		scope[name] = expanded
+	}
+	return scope, nil
+}
+
+// loopValues returns the values of a for loop: the "in" list, or the "range" first..last
+// zero-padded to "pad" digits.
+func loopValues(item DocumentOperation, vars map[string]string) ([]string, error) {
+	if (len(item.In) > 0) == (item.Range != "") {
+		return nil, fmt.Errorf("for %s needs exactly one of \"in\" and \"range\"", item.For)
+	}
+
+	var values []string
+	for _, v := range item.In {
+		value, err := substitute(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if item.Range == "" {
+		return values, nil
+	}
+
+	bounds, err := substitute(item.Range, vars)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(bounds, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("range must look like <first>..<last>, got %q", bounds)
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	last, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || last < first {
+		return nil, fmt.Errorf("invalid range %q", bounds)
+	}
+	for n := first; n <= last; n++ {
+		values = append(values, fmt.Sprintf("%0*d", item.Pad, n))
+	}
+	return values, nil
+}
+
+// substitute replaces "${name}" placeholders; an undefined variable is an error.
+// "$${name}" is kept as a literal "${name}".
+func substitute(s string, vars map[string]string) (string, error) {
+	var missing []string
+	result := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable ${%s}", missing[0])
+	}
+	return result, nil
+}
+
+// loadScenarioDocument decodes one YAML or JSON file, rejecting unknown fields, and
+// records the line every entry starts on.
+func loadScenarioDocument(filename string) (ScenarioDocument, error) {
+	var doc ScenarioDocument
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return doc, err
+	}
+
+	isJSON := strings.ToLower(filepath.Ext(filename)) == ".json"
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid JSON scenario %s: %v", filename, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid YAML scenario %s: %v", filename, err)
+		}
+	}
+	if doc.Format != 0 && doc.Format != currentFormatVersion {
+		return doc, fmt.Errorf("unsupported scenario format %d in %s (YAML and JSON scenarios use format %d)", doc.Format, filename, currentFormatVersion)
+	}
+
+	// JSON is read through the YAML parser too, just for line numbers; if that fails
+	// (e.g. tab indentation) only top-level entries get exact lines
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err == nil && root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		assignLines(doc.Operations, mappingValue(root.Content[0], "operations"), 0)
+	} else if isJSON {
+		for i, line := range jsonOperationLines(data) {
+			if i < len(doc.Operations) {
+				assignLines(doc.Operations[i:i+1], nil, line)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// assignLines copies the line of every sequence element onto items, recursing into
+// "do"; without a node the items inherit parentLine.
+func assignLines(items []DocumentOperation, seq *yaml.Node, parentLine int) {
+	for i := range items {
+		items[i].Line = parentLine
+		var node *yaml.Node
+		if seq != nil && seq.Kind == yaml.SequenceNode && i < len(seq.Content) {
+			node = seq.Content[i]
+			items[i].Line = node.Line
+		}
+		assignLines(items[i].Do, mappingValue(node, "do"), items[i].Line)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// jsonOperationLines returns the line each element of the top-level "operations" array starts on.
+func jsonOperationLines(data []byte) []int {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		var skip json.RawMessage
+		if key != "operations" {
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+			continue
+		}
+		if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil
+		}
+		var lines []int
+		for decoder.More() {
+			// InputOffset is just past the previous token; skip to the element itself
+			offset := int(decoder.InputOffset())
+			for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+				offset++
+			}
+			lines = append(lines, 1+bytes.Count(data[:offset], []byte("\n")))
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+// parseFormatMarker reports whether record is a "#scenario-format: N" line and returns N.
+func parseFormatMarker(record []string) (int, bool, error) {
+	if len(record) != 1 || !strings.HasPrefix(strings.TrimSpace(record[0]), formatMarker) {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), formatMarker)))
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid format marker %q", record[0])
+	}
+	if version > currentFormatVersion {
+		return version, true, fmt.Errorf("scenario format %d is newer than this tool supports (%d)", version, currentFormatVersion)
+	}
+	return version, true, nil
+}
+
+// columnAliases are alternative header spellings.
+var columnAliases = map[string]string{
+	"operation":   "op",
+	"file":        "path",
+	"commit":      "message",
+	"target_path": "target",
+	"repository":  "repo",
+}
+
+// parseHeader reports whether record is a header row (it names both "path" and "op") and
+// returns, for every entry of scenarioColumns, the index it appears at or -1. Unknown
+// column names are an error; columns starting with "x-" are dropped by the conversion.
+func parseHeader(record []string) ([]int, bool, error) {
+	names := make([]string, len(record))
+	isHeader := map[string]bool{}
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		names[i] = name
+		isHeader[name] = true
+	}
+	if !isHeader["path"] || !isHeader["op"] {
+		return nil, false, nil
+	}
+
+	positions := make([]int, len(scenarioColumns))
+	for i := range positions {
+		positions[i] = -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		column := -1
+		for j, known := range scenarioColumns {
+			if name == known {
+				column = j
+			}
+		}
+		if column < 0 {
+			return nil, true, fmt.Errorf("unknown column %q in header (known: %s; prefix custom columns with x-)", record[i], strings.Join(scenarioColumns, ", "))
+		}
+		if positions[column] >= 0 {
+			return nil, true, fmt.Errorf("column %q appears more than once in header", name)
+		}
+		positions[column] = i
+	}
+	if positions[2] < 0 {
+		return nil, true, fmt.Errorf("header has no %q column", "message")
+	}
+	return positions, true, nil
+}
+
+// reorderRecord returns record in the scenarioColumns order described by positions.
+func reorderRecord(record []string, positions []int) []string {
+	var reordered []string
+	for column, index := range positions {
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		for len(reordered) < column {
+			reordered = append(reordered, "")
+		}
+		reordered = append(reordered, record[index])
+	}
+	return reordered
+}
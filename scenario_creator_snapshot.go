@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// globList lets --include and --exclude be given more than once.
+type globList []string
+
+func (g *globList) String() string     { return strings.Join(*g, ",") }
+func (g *globList) Set(v string) error { *g = append(*g, v); return nil }
+
+// snapshotFile is one file found in the source tree.
+type snapshotFile struct {
+	Path string
+	Read func() ([]byte, error)
+}
+
+func main() {
+	var includes, excludes globList
+	dir := flag.String("dir", "", "Directory to snapshot")
+	repoPath := flag.String("repo", "", "Git repository to snapshot (alternative to --dir)")
+	ref := flag.String("ref", "HEAD", "Commit, branch or tag to snapshot when --repo is used")
+	prefix := flag.String("prefix", "", "Path prefix for the files in the scenario (e.g. customer_p)")
+	flag.Var(&includes, "include", "Glob of files to include (repeatable; default: everything)")
+	flag.Var(&excludes, "exclude", "Glob of files to exclude (repeatable)")
+	embed := flag.Bool("embed-content", false, "Put file content into the scenario instead of creating empty files")
+	contentDir := flag.String("content-dir", "", "Directory for content that cannot be stored inline (default: <output>_content)")
+	message := flag.String("message", "initial commit", "Commit message for every row")
+	outputFile := flag.String("output", "scenario_snapshot.csv", "Path of the scenario CSV to write")
+	flag.Parse()
+
+	if (*dir == "") == (*repoPath == "") {
+		fmt.Println("Usage: go run scenario_creator_snapshot.go (--dir <path> | --repo <path> [--ref <ref>]) [--prefix p] [--include glob] [--exclude glob] [--embed-content] [--output file.csv]")
+		os.Exit(1)
+	}
+	if *contentDir == "" {
+		*contentDir = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile)) + "_content"
+	}
+
+	var files []snapshotFile
+	var err error
+	if *dir != "" {
+		files, err = filesFromDir(*dir)
+	} else {
+		files, err = filesFromGit(*repoPath, *ref)
+	}
+	if err != nil {
+		fmt.Println("Failed to read source tree:", err)
+		os.Exit(1)
+	}
+
+	file, err := os.Create(*outputFile)
+	if err != nil {
+		fmt.Println("Failed to create CSV:", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{fmt.Sprintf("%s %d", formatMarker, currentFormatVersion)})
+	writer.Write([]string{"path", "op", "message", "content"})
+
+	rows := 0
+	for _, f := range files {
+		if !selected(f.Path, includes, excludes) {
+			continue
+		}
+
+		content := ""
+		if *embed {
+			data, err := f.Read()
+			if err != nil {
+				fmt.Printf("Failed to read %s: %v\n", f.Path, err)
+				os.Exit(1)
+			}
+			content, err = contentColumn(data, *outputFile, *contentDir)
+			if err != nil {
+				fmt.Printf("Failed to store content of %s: %v\n", f.Path, err)
+				os.Exit(1)
+			}
+		}
+
+		writer.Write([]string{
+			path.Join(*prefix, f.Path),
+			"create",
+			*message,
+			content,
+		})
+		rows++
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		fmt.Println("Failed to write CSV:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s created successfully: %d file(s).\n", *outputFile, rows)
+}
+
+func filesFromDir(root string) ([]snapshotFile, error) {
+	var files []snapshotFile
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		full := p
+		files = append(files, snapshotFile{
+			Path: filepath.ToSlash(rel),
+			Read: func() ([]byte, error) { return os.ReadFile(full) },
+		})
+		return nil
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, err
+}
+
+func filesFromGit(repoPath, ref string) ([]snapshotFile, error) {
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository at %s: %v", repoPath, err)
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []snapshotFile
+	err = tree.Files().ForEach(func(f *object.File) error {
+		blob := f
+		files = append(files, snapshotFile{
+			Path: f.Name,
+			Read: func() ([]byte, error) {
+				content, err := blob.Contents()
+				return []byte(content), err
+			},
+		})
+		return nil
+	})
+	return files, err
+}
+
+// selected applies the include globs (if any) and then the exclude globs.
+func selected(p string, includes, excludes []string) bool {
+	if len(includes) > 0 {
+		matched := false
+		for _, pattern := range includes {
+			if matchGlob(pattern, p) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, pattern := range excludes {
+		if matchGlob(pattern, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGlob matches like .gitignore-lite: "dir/**" matches everything below dir, a
+// pattern with a slash matches the whole path, and one without matches the file name.
+func matchGlob(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.HasPrefix(p, strings.TrimSuffix(pattern, "**"))
+	}
+	if strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, p)
+		return ok
+	}
+	ok, _ := path.Match(pattern, path.Base(p))
+	return ok
+}
+
+// contentColumn keeps text inline when CSV trimming would not change it and writes anything
+// else (binary, surrounding whitespace) to contentDir, returning an "@file:" reference.
+func contentColumn(data []byte, outputFile, contentDir string) (string, error) {
+	content := string(data)
+	if content == "" {
+		return "", nil
+	}
+	if content == strings.TrimSpace(content) && !strings.Contains(content, "\x00") && !strings.HasPrefix(content, "@file:") {
+		return content, nil
+	}
+
+	if err := os.MkdirAll(contentDir, 0755); err != nil {
+		return "", err
+	}
+	blobPath := filepath.Join(contentDir, plumbing.ComputeHash(plumbing.BlobObject, data).String())
+	if err := os.WriteFile(blobPath, data, 0644); err != nil {
+		return "", err
+	}
+
+	// References are resolved relative to the scenario file
+	rel, err := filepath.Rel(filepath.Dir(outputFile), blobPath)
+	if err != nil {
+		rel = blobPath
+	}
+	return "@file:" + filepath.ToSlash(rel), nil
+}
+
+// currentFormatVersion is the scenario format this tool writes.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+func main() {
+	repoPath := flag.String("repo", "", "Path to the Git repository")
+	from := flag.String("from", "", "Ref the scenario starts from (e.g. main)")
+	to := flag.String("to", "", "Ref the scenario should produce (e.g. feature/x)")
+	message := flag.String("message", "", "Commit message for every row (default: \"apply <from>..<to>\")")
+	author := flag.String("author", "", "Optional commit author for every row, as \"Name <email>\"")
+	outputFile := flag.String("output", "scenario_diff.csv", "Path of the scenario CSV to write")
+	contentDir := flag.String("content-dir", "", "Directory for content that cannot be stored inline (default: <output>_content)")
+	flag.Parse()
+
+	if *repoPath == "" || *from == "" || *to == "" {
+		log.Fatal("Flags --repo, --from and --to are required.")
+	}
+	if *message == "" {
+		*message = fmt.Sprintf("apply %s..%s", *from, *to)
+	}
+	if *contentDir == "" {
+		*contentDir = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile)) + "_content"
+	}
+
+	repo, err := git.PlainOpen(*repoPath)
+	if err != nil {
+		log.Fatalf("Failed to open repository at %s: %v", *repoPath, err)
+	}
+	fromTree, err := treeAtRef(repo, *from)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	toTree, err := treeAtRef(repo, *to)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	records, err := diffScenario(fromTree, toTree, *message, *author, *outputFile, *contentDir)
+	if err != nil {
+		log.Fatalf("Failed to diff %s..%s: %v", *from, *to, err)
+	}
+
+	file, err := os.Create(*outputFile)
+	if err != nil {
+		log.Fatalf("Failed to create CSV: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{fmt.Sprintf("%s %d", formatMarker, currentFormatVersion)})
+	writer.Write([]string{"path", "op", "message", "content", "author", "target"})
+	for _, record := range records {
+		writer.Write(record)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	fmt.Printf("%s created successfully: %d row(s) transform %s into %s.\n", *outputFile, len(records), *from, *to)
+}
+
+func treeAtRef(repo *git.Repository, ref string) (*object.Tree, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %v", hash, err)
+	}
+	return commit.Tree()
+}
+
+// diffScenario builds the rows that turn fromTree into toTree. Moves come first (their
+// sources must still exist), then deletes, creates and updates. A file that is replaced
+// by a folder is deleted before the moves, and moved before any move into that folder,
+// because the folder cannot be created while the file is there. A folder that disappears
+// completely is deleted with a single row instead of one row per file.
+func diffScenario(fromTree, toTree *object.Tree, message, author, outputFile, contentDir string) ([][]string, error) {
+	changes, err := object.DiffTreeWithOptions(context.Background(), fromTree, toTree, &object.DiffTreeOptions{DetectRenames: true})
+	if err != nil {
+		return nil, err
+	}
+
+	row := func(p, op, content string, extra ...string) []string {
+		record := []string{p, op, message, content, author}
+		return append(record, extra...)
+	}
+
+	var moves, deletes, creates, updates [][]string
+	var deleted, targets []string
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		// A file cannot be moved below itself: y becoming y/new is a delete and a create
+		if action == merkletrie.Modify && strings.HasPrefix(ch.To.Name, ch.From.Name+"/") {
+			deleted = append(deleted, ch.From.Name)
+			ch.From.Name = ""
+		}
+
+		switch {
+		case action == merkletrie.Modify && ch.From.Name != ch.To.Name && ch.From.Name != "": // rename detected
+			moves = append(moves, row(ch.From.Name, "move", "", ch.To.Name))
+			targets = append(targets, ch.To.Name)
+			if ch.From.TreeEntry.Hash != ch.To.TreeEntry.Hash {
+				content, err := contentColumn(toTree, ch.To.Name, outputFile, contentDir)
+				if err != nil {
+					return nil, err
+				}
+				updates = append(updates, row(ch.To.Name, "update", content))
+			}
+		case ch.From.Name == "":
+			content := "" // a create without content makes an empty file
+			if !isEmptyBlob(ch.To.TreeEntry.Hash) {
+				if content, err = contentColumn(toTree, ch.To.Name, outputFile, contentDir); err != nil {
+					return nil, err
+				}
+			}
+			creates = append(creates, row(ch.To.Name, "create", content))
+			targets = append(targets, ch.To.Name)
+		case ch.To.Name == "":
+			deleted = append(deleted, ch.From.Name)
+		default:
+			content, err := contentColumn(toTree, ch.To.Name, outputFile, contentDir)
+			if err != nil {
+				return nil, err
+			}
+			updates = append(updates, row(ch.To.Name, "update", content))
+		}
+	}
+
+	var clearing [][]string
+	for _, p := range collapseDeletes(fromTree, toTree, deleted) {
+		if hasPathBelow(targets, p) {
+			clearing = append(clearing, row(p, "delete", ""))
+		} else {
+			deletes = append(deletes, row(p, "delete", ""))
+		}
+	}
+
+	var records [][]string
+	for _, group := range [][][]string{clearing, orderMoves(moves), deletes, creates, updates} {
+		records = append(records, group...)
+	}
+	return records, nil
+}
+
+// collapseDeletes replaces deleted files by the highest folder that no longer exists in
+// toTree, so removing a whole cluster is one row.
+func collapseDeletes(fromTree, toTree *object.Tree, deleted []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, p := range deleted {
+		target := p
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if _, err := toTree.FindEntry(dir); err == nil {
+				break
+			}
+			if _, err := fromTree.FindEntry(dir); err != nil {
+				break
+			}
+			target = dir
+		}
+		if !seen[target] {
+			seen[target] = true
+			result = append(result, target)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// orderMoves puts a move after the moves that take a file away from a folder its target
+// lies in. Moves that wait for each other in a cycle keep their order; the executor
+// reports the one that cannot be applied.
+func orderMoves(moves [][]string) [][]string {
+	var ordered [][]string
+	pending := moves
+	for len(pending) > 0 {
+		var waiting [][]string
+		for _, move := range pending {
+			blocked := false
+			for _, other := range pending {
+				if other[0] != move[0] && strings.HasPrefix(move[5], other[0]+"/") {
+					blocked = true
+					break
+				}
+			}
+			if blocked {
+				waiting = append(waiting, move)
+			} else {
+				ordered = append(ordered, move)
+			}
+		}
+		if len(waiting) == len(pending) {
+			return append(ordered, waiting...)
+		}
+		pending = waiting
+	}
+	return ordered
+}
+
+// hasPathBelow reports whether one of paths lies below dir.
+func hasPathBelow(paths []string, dir string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// contentColumn returns the file content inline when the executor would read it back
+// unchanged, otherwise it stores the blob under contentDir and returns "@file:<path>".
+func contentColumn(tree *object.Tree, name, outputFile, contentDir string) (string, error) {
+	file, err := tree.File(name)
+	if err != nil {
+		return "", err
+	}
+
+	binary, err := file.IsBinary()
+	if err != nil {
+		return "", err
+	}
+	if !binary {
+		content, err := file.Contents()
+		if err != nil {
+			return "", err
+		}
+		// The executor trims fields
+		if content == strings.TrimSpace(content) && !strings.HasPrefix(content, "@file:") {
+			return content, nil
+		}
+	}
+
+	if err := os.MkdirAll(contentDir, 0755); err != nil {
+		return "", err
+	}
+	blobPath := filepath.Join(contentDir, file.Hash.String())
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		reader, err := file.Reader()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		out, err := os.Create(blobPath)
+		if err != nil {
+			return "", err
+		}
+		defer out.Close()
+		if _, err := out.ReadFrom(reader); err != nil {
+			return "", err
+		}
+	}
+
+	// References are resolved relative to the scenario file
+	rel, err := filepath.Rel(filepath.Dir(outputFile), blobPath)
+	if err != nil {
+		rel = blobPath
+	}
+	return "@file:" + filepath.ToSlash(rel), nil
+}
+
+// isEmptyBlob reports whether hash is git's well-known empty blob.
+func isEmptyBlob(hash plumbing.Hash) bool {
+	return hash.String() == "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+}
+
+// currentFormatVersion is the scenario format this tool writes.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
@@ -1,525 +1,2622 @@
-package main
-
-import (
-	"encoding/base64"
-	"encoding/csv"
-	"flag"
-	"fmt"
-	"io"
-	"log"
-	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
-	"time"
-)
-
-type ScenarioOperation struct {
-	FilePath      string
-	OperationType string
-	CommitMessage string
-	FileContent   string
-	LineNumber    int
-}
-
-func main() {
-	var repoPath, scenarioPath, logPath, githubUsername, githubToken string
-	
-	flag.StringVar(&repoPath, "repo", "", "Path to git repository")
-	flag.StringVar(&scenarioPath, "scenario", "", "Path to scenario CSV file")
-	flag.StringVar(&logPath, "log", "execution_o.log", "Path to log file")
-	flag.StringVar(&githubUsername, "username", "", "GitHub username")
-	flag.StringVar(&githubToken, "token", "", "GitHub personal access token")
-	flag.Parse()
-	
-	if repoPath == "" || scenarioPath == "" || githubUsername == "" || githubToken == "" {
-		fmt.Println("Usage: git_scenario_execute --repo /path/to/repo --scenario /path/to/scenario.csv --username <github_username> --token <github_token> [--log /path/to/log]")
-		os.Exit(1)
-	}
-	
-	// Setup logging
-	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err != nil {
-		fmt.Printf("Error opening log file: %v\n", err)
-		os.Exit(1)
-	}
-	defer logFile.Close()
-	
-	logger := log.New(logFile, "", 0)
-	
-	// Log execution start
-	logger.Printf("[%s] === Scenario execution started ===", time.Now().Format("2006-01-02 15:04:05"))
-	logger.Printf("[%s] Repository: %s", time.Now().Format("2006-01-02 15:04:05"), repoPath)
-	logger.Printf("[%s] Scenario file: %s", time.Now().Format("2006-01-02 15:04:05"), scenarioPath)
-	logger.Printf("[%s] GitHub username: %s", time.Now().Format("2006-01-02 15:04:05"), githubUsername)
-	
-	// Read scenario CSV
-	operations, err := readScenarioCSV(scenarioPath)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to read scenario file: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-		fmt.Printf("Error reading scenario file: %v\n", err)
-		os.Exit(1)
-	}
-	
-	logger.Printf("[%s] Total operations to execute: %d", time.Now().Format("2006-01-02 15:04:05"), len(operations))
-	
-	// Change to repository directory
-	err = os.Chdir(repoPath)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to change to repository directory: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-		fmt.Printf("Error changing to repository directory: %v\n", err)
-		os.Exit(1)
-	}
-	
-	// Configure git credentials (after changing to repo directory)
-	err = configureGitCredentials(githubUsername, githubToken, logger)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to configure git credentials: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-		fmt.Printf("Error configuring git credentials: %v\n", err)
-		os.Exit(1)
-	}
-	
-	// Configure git credentials (after changing to repo directory)
-	err = configureGitCredentials(githubUsername, githubToken, logger)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to configure git credentials: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-		fmt.Printf("Error configuring git credentials: %v\n", err)
-		os.Exit(1)
-	}
-	
-	// Execute operations
-	successCount := 0
-	for _, op := range operations {
-		logger.Printf("[%s] --- Executing line %d ---", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber)
-		
-		success := executeOperation(op, logger, scenarioPath)
-		if success {
-			successCount++
-			logger.Printf("[%s] Line %d completed successfully", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber)
-		} else {
-			logger.Printf("[%s] Line %d failed", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber)
-		}
-		
-		// Add a small delay between operations
-		time.Sleep(100 * time.Millisecond)
-	}
-	
-	logger.Printf("[%s] === Scenario execution completed ===", time.Now().Format("2006-01-02 15:04:05"))
-	logger.Printf("[%s] Success: %d/%d operations", time.Now().Format("2006-01-02 15:04:05"), successCount, len(operations))
-	
-	fmt.Printf("Execution completed. Success: %d/%d operations\n", successCount, len(operations))
-	fmt.Printf("Check log file for details: %s\n", logPath)
-}
-
-func readScenarioCSV(filename string) ([]ScenarioOperation, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	
-	reader := csv.NewReader(file)
-	// Make CSV parsing more flexible
-	reader.FieldsPerRecord = -1 // Allow variable number of fields
-	reader.TrimLeadingSpace = true
-	
-	var operations []ScenarioOperation
-	lineNumber := 1
-	
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, fmt.Errorf("CSV parsing error at line %d: %v", lineNumber, err)
-		}
-		
-		// Skip empty lines
-		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
-			lineNumber++
-			continue
-		}
-		
-		// Validate minimum required fields
-		if len(record) < 3 {
-			return nil, fmt.Errorf("invalid CSV format at line %d: expected at least 3 columns, got %d columns. Record: %v", lineNumber, len(record), record)
-		}
-		
-		// Trim whitespace from all fields
-		for i := range record {
-			record[i] = strings.TrimSpace(record[i])
-		}
-		
-		op := ScenarioOperation{
-			FilePath:      record[0],
-			OperationType: record[1],
-			CommitMessage: record[2],
-			LineNumber:    lineNumber,
-		}
-		
-		// Validate operation type
-		if op.OperationType != "create" && op.OperationType != "update" {
-			return nil, fmt.Errorf("invalid operation type '%s' at line %d: must be 'create' or 'update'", op.OperationType, lineNumber)
-		}
-		
-		// Add file content if available (for update operations)
-		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
-			op.FileContent = record[3]
-		} else if op.OperationType == "update" {
-			// Default content for update operations if not specified
-			op.FileContent = "test data"
-		}
-		
-		operations = append(operations, op)
-		lineNumber++
-	}
-	
-	return operations, nil
-}
-
-func executeOperation(op ScenarioOperation, logger *log.Logger, scenarioFile string) bool {
-	logger.Printf("[%s] Operation: %s on %s", time.Now().Format("2006-01-02 15:04:05"), op.OperationType, op.FilePath)
-	
-	// Step 1: Pull
-	if !executeGitCommand("pull", logger, scenarioFile, op.LineNumber) {
-		return false
-	}
-	
-	// Step 2: Execute the operation
-	var success bool
-	switch op.OperationType {
-	case "create":
-		success = executeCreateOperation(op, logger, scenarioFile)
-	case "update":
-		success = executeUpdateOperation(op, logger, scenarioFile)
-	default:
-		logger.Printf("[%s] ERROR: Unknown operation type: %s (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), op.OperationType, scenarioFile, op.LineNumber)
-		return false
-	}
-	
-	if !success {
-		return false
-	}
-	
-	// Step 3: Add and commit
-	if !executeGitCommand(fmt.Sprintf("add %s", op.FilePath), logger, scenarioFile, op.LineNumber) {
-		return false
-	}
-	
-	// Check if there are any changes to commit
-	if !hasChangesToCommit(logger, scenarioFile, op.LineNumber) {
-		logger.Printf("[%s] No changes to commit for %s, skipping commit", time.Now().Format("2006-01-02 15:04:05"), op.FilePath)
-		return true
-	}
-	
-	if !executeGitCommand(fmt.Sprintf("commit -m %q", op.CommitMessage), logger, scenarioFile, op.LineNumber) {
-		return false
-	}
-	
-	// Step 4: Push
-	if !executeGitCommand("push", logger, scenarioFile, op.LineNumber) {
-		return false
-	}
-	
-	return true
-}
-
-func configureGitCredentials(username, token string, logger *log.Logger) error {
-	logger.Printf("[%s] Configuring git credentials with HTTP Basic Auth...", time.Now().Format("2006-01-02 15:04:05"))
-	
-	// Set git config for the current repository (local config)
-	cmd := exec.Command("git", "config", "--local", "user.name", username)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		logger.Printf("[%s] ERROR: Git config user.name output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
-		return fmt.Errorf("failed to set git user.name: %v", err)
-	}
-	
-	// Set default email
-	email := username + "@users.noreply.github.com"
-	cmd = exec.Command("git", "config", "--local", "user.email", email)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		logger.Printf("[%s] ERROR: Git config user.email output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
-		return fmt.Errorf("failed to set git user.email: %v", err)
-	}
-	
-	logger.Printf("[%s] Set git user.name: %s", time.Now().Format("2006-01-02 15:04:05"), username)
-	logger.Printf("[%s] Set git user.email: %s", time.Now().Format("2006-01-02 15:04:05"), email)
-	
-	// Configure HTTP Basic Auth for GitHub
-	// Set credential helper to store credentials
-	cmd = exec.Command("git", "config", "--local", "credential.helper", "store")
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		logger.Printf("[%s] ERROR: Git config credential.helper output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
-		return fmt.Errorf("failed to set credential helper: %v", err)
-	}
-	
-	// Configure HTTP Basic Auth specifically for github.com
-	cmd = exec.Command("git", "config", "--local", "http.https://github.com/.extraheader", fmt.Sprintf("Authorization: Basic %s", encodeBasicAuth(username, token)))
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		logger.Printf("[%s] ERROR: Git config http auth output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
-		return fmt.Errorf("failed to set HTTP basic auth: %v", err)
-	}
-	
-	// Alternative approach: Set credential.username and use askpass helper
-	cmd = exec.Command("git", "config", "--local", "credential.https://github.com.username", username)
-	output, err = cmd.CombinedOutput()
-	if err != nil {
-		logger.Printf("[%s] WARNING: Failed to set credential username: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-	}
-	
-	// Ensure we're using HTTPS URL (not SSH)
-	err = ensureHTTPSRemote(logger)
-	if err != nil {
-		logger.Printf("[%s] WARNING: Failed to ensure HTTPS remote: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-	}
-	
-	// Create credential file for git credential store
-	err = createCredentialFile(username, token, logger)
-	if err != nil {
-		logger.Printf("[%s] WARNING: Failed to create credential file: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-	}
-	
-	logger.Printf("[%s] Git HTTP Basic Auth configured successfully", time.Now().Format("2006-01-02 15:04:05"))
-	return nil
-}
-
-func encodeBasicAuth(username, token string) string {
-	auth := username + ":" + token
-	return base64.StdEncoding.EncodeToString([]byte(auth))
-}
-
-func ensureHTTPSRemote(logger *log.Logger) error {
-	// Set the specific GitHub repository URL
-	targetURL := "https://github.com/airitech-soe/csv-go-git-ops.git"
-	
-	// Get current remote URL
-	cmd := exec.Command("git", "remote", "get-url", "origin")
-	output, err := cmd.Output()
-	if err != nil {
-		logger.Printf("[%s] No remote origin found, adding it...", time.Now().Format("2006-01-02 15:04:05"))
-		// Add the remote if it doesn't exist
-		cmd = exec.Command("git", "remote", "add", "origin", targetURL)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to add remote origin: %v, output: %s", err, string(output))
-		}
-		logger.Printf("[%s] Added remote origin: %s", time.Now().Format("2006-01-02 15:04:05"), targetURL)
-		return nil
-	}
-	
-	remoteURL := strings.TrimSpace(string(output))
-	logger.Printf("[%s] Current remote URL: %s", time.Now().Format("2006-01-02 15:04:05"), remoteURL)
-	
-	// Always set to our target URL to ensure consistency
-	if remoteURL != targetURL {
-		cmd = exec.Command("git", "remote", "set-url", "origin", targetURL)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to set remote URL: %v, output: %s", err, string(output))
-		}
-		logger.Printf("[%s] Updated remote URL to: %s", time.Now().Format("2006-01-02 15:04:05"), targetURL)
-	} else {
-		logger.Printf("[%s] Remote URL is already correct", time.Now().Format("2006-01-02 15:04:05"))
-	}
-	
-	return nil
-}
-
-func createCredentialFile(username, token string, logger *log.Logger) error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
-	}
-	
-	credentialFile := filepath.Join(homeDir, ".git-credentials")
-	// Use the specific repository URL
-	credentialEntry := fmt.Sprintf("https://%s:%s@github.com/airitech-soe/csv-go-git-ops.git\n", username, token)
-	
-	// Check if file exists and if our entry is already there
-	if _, err := os.Stat(credentialFile); err == nil {
-		content, err := os.ReadFile(credentialFile)
-		if err == nil && strings.Contains(string(content), "github.com/airitech-soe/csv-go-git-ops") {
-			logger.Printf("[%s] Credential file already contains entry for csv-go-git-ops repository", time.Now().Format("2006-01-02 15:04:05"))
-			return nil
-		}
-	}
-	
-	// Append our credentials to the file
-	file, err := os.OpenFile(credentialFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to open credential file: %v", err)
-	}
-	defer file.Close()
-	
-	_, err = file.WriteString(credentialEntry)
-	if err != nil {
-		return fmt.Errorf("failed to write to credential file: %v", err)
-	}
-	
-	logger.Printf("[%s] Created/updated git credential file for repository: https://github.com/airitech-soe/csv-go-git-ops.git", time.Now().Format("2006-01-02 15:04:05"))
-	return nil
-}
-
-func executeCreateOperation(op ScenarioOperation, logger *log.Logger, scenarioFile string) bool {
-	// Create directory if it doesn't exist
-	dir := filepath.Dir(op.FilePath)
-	err := os.MkdirAll(dir, 0755)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to create directory %s: %v (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), dir, err, scenarioFile, op.LineNumber)
-		return false
-	}
-	
-	// Create empty file
-	file, err := os.Create(op.FilePath)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to create file %s: %v (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, err, scenarioFile, op.LineNumber)
-		return false
-	}
-	defer file.Close()
-	
-	logger.Printf("[%s] Created file: %s", time.Now().Format("2006-01-02 15:04:05"), op.FilePath)
-	return true
-}
-
-func executeUpdateOperation(op ScenarioOperation, logger *log.Logger, scenarioFile string) bool {
-	// Check if file exists
-	if _, err := os.Stat(op.FilePath); os.IsNotExist(err) {
-		logger.Printf("[%s] ERROR: File does not exist for update: %s (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, scenarioFile, op.LineNumber)
-		return false
-	}
-	
-	// Read current content to check if update is needed
-	currentContent, err := os.ReadFile(op.FilePath)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to read current file content %s: %v (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, err, scenarioFile, op.LineNumber)
-		return false
-	}
-	
-	// Check if content is already the same
-	if string(currentContent) == op.FileContent {
-		logger.Printf("[%s] File %s already has the same content, no update needed", 
-			time.Now().Format("2006-01-02 15:04:05"), op.FilePath)
-		return true
-	}
-	
-	// Write content to file
-	err = os.WriteFile(op.FilePath, []byte(op.FileContent), 0644)
-	if err != nil {
-		logger.Printf("[%s] ERROR: Failed to update file %s: %v (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, err, scenarioFile, op.LineNumber)
-		return false
-	}
-	
-	logger.Printf("[%s] Updated file: %s with content: %s", time.Now().Format("2006-01-02 15:04:05"), op.FilePath, op.FileContent)
-	return true
-}
-
-func hasChangesToCommit(logger *log.Logger, scenarioFile string, lineNumber int) bool {
-	cmd := exec.Command("git", "diff", "--cached", "--quiet")
-	err := cmd.Run()
-	
-	// git diff --cached --quiet returns:
-	// - exit code 0 if no changes (no differences)
-	// - exit code 1 if there are changes
-	// - other exit codes for errors
-	
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
-			// Exit code 1 means there are staged changes
-			return true
-		}
-		// Other exit codes indicate an error
-		logger.Printf("[%s] WARNING: Error checking for staged changes: %v (scenario: %s, line: %d)", 
-			time.Now().Format("2006-01-02 15:04:05"), err, scenarioFile, lineNumber)
-		return true // Assume there are changes to be safe
-	}
-	
-	// Exit code 0 means no staged changes
-	return false
-}
-
-func executeGitCommand(gitCmd string, logger *log.Logger, scenarioFile string, lineNumber int) bool {
-	// Parse the command more carefully to handle quotes properly
-	parts := parseGitCommand(gitCmd)
-	cmd := exec.Command("git", parts...)
-	
-	logger.Printf("[%s] Executing: git %s", time.Now().Format("2006-01-02 15:04:05"), gitCmd)
-	
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		// Special handling for common git errors
-		outputStr := string(output)
-		if strings.Contains(outputStr, "nothing to commit") || strings.Contains(outputStr, "no changes added to commit") {
-			logger.Printf("[%s] INFO: No changes to commit - this is expected in some cases", time.Now().Format("2006-01-02 15:04:05"))
-			return true
-		}
-		
-		logger.Printf("[%s] ERROR: Git command failed: git %s", time.Now().Format("2006-01-02 15:04:05"), gitCmd)
-		logger.Printf("[%s] ERROR: %v", time.Now().Format("2006-01-02 15:04:05"), err)
-		logger.Printf("[%s] ERROR: Output: %s", time.Now().Format("2006-01-02 15:04:05"), outputStr)
-		logger.Printf("[%s] ERROR: Scenario file: %s, Line: %d", time.Now().Format("2006-01-02 15:04:05"), scenarioFile, lineNumber)
-		return false
-	}
-	
-	if len(output) > 0 {
-		logger.Printf("[%s] Git output: %s", time.Now().Format("2006-01-02 15:04:05"), strings.TrimSpace(string(output)))
-	}
-	
-	return true
-}
-
-func parseGitCommand(gitCmd string) []string {
-	// Handle commands with quoted arguments properly
-	var parts []string
-	var current strings.Builder
-	inQuotes := false
-	escaped := false
-	
-	for _, char := range gitCmd {
-		if escaped {
-			current.WriteRune(char)
-			escaped = false
-			continue
-		}
-		
-		if char == '\\' {
-			escaped = true
-			continue
-		}
-		
-		if char == '"' || char == '\'' {
-			if !inQuotes {
-				inQuotes = true
-			} else {
-				inQuotes = false
-			}
-			continue
-		}
-		
-		if char == ' ' && !inQuotes {
-			if current.Len() > 0 {
-				parts = append(parts, current.String())
-				current.Reset()
-			}
-		} else {
-			current.WriteRune(char)
-		}
-	}
-	
-	// Add the last part
-	if current.Len() > 0 {
-		parts = append(parts, current.String())
-	}
-	
-	return parts
-}
\ No newline at end of file
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Exit codes shared by all executors
+const (
+	exitSuccess        = 0 // every scenario line succeeded
+	exitPartialFailure = 1 // the run finished (or was stopped by --on-error) with failed lines
+	exitFatal          = 2 // the run could not start or could not be completed
+)
+
+type ScenarioOperation struct {
+	FilePath      string
+	OperationType string
+	CommitMessage string
+	FileContent   string
+	Author        string // optional "Name <email>" for the commit
+	TargetPath    string // destination for move operations
+	LineNumber    int
+	Origin        string    // file:line and loop values, for operations expanded from a YAML/JSON template
+	Repository    string    // repository name or path from the repo column; empty means --repo
+	Time          time.Time // when the operation originally happened; zero without a time column
+}
+
+// OperationResult records the outcome of a single scenario line for the execution report.
+type OperationResult struct {
+	LineNumber    int       `json:"line"`
+	FilePath      string    `json:"path"`
+	OperationType string    `json:"operation"`
+	CommitMessage string    `json:"message"`
+	Origin        string    `json:"origin,omitempty"`
+	Repository    string    `json:"repository,omitempty"`
+	Status        string    `json:"status"` // "success", "failed", "skipped" or "rolled_back"
+	Error         string    `json:"error,omitempty"`
+	CommitSHA     string    `json:"commit_sha,omitempty"`
+	FilesTouched  []string  `json:"files_touched,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	DurationMs    int64     `json:"duration_ms"`
+	Signature     string    `json:"signature,omitempty"` // with --sign: "good", "untrusted", "bad", "expired", "revoked", "unverifiable" or "unsigned"
+	Signer        string    `json:"signer,omitempty"`
+}
+
+// ExecutionOptions holds the tunables that change how each operation is executed.
+type ExecutionOptions struct {
+	SyncStrategy string        // "rebase" or "merge", used when a push is rejected
+	PushRetries  int           // how many times a rejected push is re-synced and retried
+	PushBackoff  time.Duration // initial wait between push attempts, doubled each time
+	Retry        RetryPolicy   // applied to pull, fetch and push on transient failures
+	OnError      FailurePolicy // what to do after a line fails
+	Atomic       bool          // commit locally only; pull and push happen once for the whole run
+	Parallel     int           // how many repositories run at the same time
+	OpPacing     Pacer         // spacing between operations, shared by all workers
+	PushPacing   Pacer         // spacing between pushes
+	ReplaySpeed  float64       // > 0 spaces operations by their scenario times, this many times faster
+	Provenance   string        // "trailers" or "notes" links each commit to its scenario line; "" does not
+	RunID        string        // identifies this run in trailers, notes and the report
+	
+	pushLock    sync.Mutex // pushes never overlap, even from different workers
+	replayStart time.Time  // when the replay clock started
+	replayBase  time.Time  // scenario time that corresponds to replayStart
+}
+
+// Pacer spaces events at least Interval apart, across all goroutines that share it. A
+// zero Interval never waits.
+type Pacer struct {
+	Interval time.Duration
+	
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Wait blocks until the next event may start and reserves its slot.
+func (p *Pacer) Wait() {
+	if p.Interval <= 0 {
+		return
+	}
+	p.mu.Lock()
+	now := time.Now()
+	if p.next.Before(now) {
+		p.next = now
+	}
+	wait := p.next.Sub(now)
+	p.next = p.next.Add(p.Interval)
+	p.mu.Unlock()
+	time.Sleep(wait)
+}
+
+// perUnit converts a rate into the interval between events; 0 means unlimited.
+func perUnit(rate float64, unit time.Duration) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(unit) / rate)
+}
+
+// FailurePolicy decides when a run stops after failed lines. MaxFailures of 0 means never.
+type FailurePolicy struct {
+	Mode        string // "stop", "continue" or "abort-after"
+	MaxFailures int
+}
+
+func (p FailurePolicy) shouldStop(failures int) bool {
+	return p.MaxFailures > 0 && failures >= p.MaxFailures
+}
+
+// parseFailurePolicy accepts "stop", "continue" or "abort-after=N".
+func parseFailurePolicy(value string) (FailurePolicy, error) {
+	switch {
+	case value == "stop":
+		return FailurePolicy{Mode: "stop", MaxFailures: 1}, nil
+	case value == "continue":
+		return FailurePolicy{Mode: "continue"}, nil
+	case strings.HasPrefix(value, "abort-after="):
+		n, err := strconv.Atoi(strings.TrimPrefix(value, "abort-after="))
+		if err != nil || n < 1 {
+			return FailurePolicy{}, fmt.Errorf("invalid failure count in %q", value)
+		}
+		return FailurePolicy{Mode: "abort-after", MaxFailures: n}, nil
+	}
+	return FailurePolicy{}, fmt.Errorf("must be 'stop', 'continue' or 'abort-after=N', got %q", value)
+}
+
+// RetryPolicy describes how transient git/network failures are retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64 // fraction of the delay added or removed at random, 0..1
+}
+
+// ExecutionReport is the machine-readable summary of a scenario run.
+type ExecutionReport struct {
+	Executor   string            `json:"executor"`
+	Repository string            `json:"repository"`
+	Scenario   string            `json:"scenario"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Total      int               `json:"total"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"`
+	Atomic     bool              `json:"atomic"`
+	Parallel   int               `json:"parallel"`
+	Signing    string            `json:"signing,omitempty"` // --sign format
+	RunID      string            `json:"run_id"`
+	RolledBack []string          `json:"rolled_back,omitempty"` // local commits discarded by an atomic rollback
+	Results    []OperationResult `json:"results"`
+	
+	Repositories []RepositorySummary `json:"repositories,omitempty"` // per-repository totals for multi-repository runs
+}
+
+// RepositoryConfig is one entry of the --repos map: where the clone is and, optionally,
+// the origin URL to enforce (the default repository uses --remote).
+type RepositoryConfig struct {
+	Path   string `json:"path" yaml:"path"`
+	Remote string `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+// RepositoryBatch is the part of a scenario that runs in one repository.
+type RepositoryBatch struct {
+	Name       string // repo column value, or the --repo path for rows without one
+	Path       string // absolute path of the local clone
+	Remote     string // origin URL to enforce; empty keeps the clone's origin
+	Operations []ScenarioOperation
+	Run        *AtomicRun
+	Results    []OperationResult
+}
+
+// RunProgress is the state workers share: the totals the --on-error policy looks at and
+// whether the run has been stopped.
+type RunProgress struct {
+	mu        sync.Mutex
+	Succeeded int
+	Failed    int
+	Stopped   bool
+}
+
+// RepositorySummary is the per-repository part of a combined report.
+type RepositorySummary struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	Skipped   int    `json:"skipped"`
+}
+
+// SigningConfig is how commits are signed. Format is "" (no signing), "gpg" or "ssh";
+// Key becomes user.signingkey.
+type SigningConfig struct {
+	Format         string
+	Key            string
+	AllowedSigners string // allowed signers file for verifying SSH signatures
+}
+
+// signing applies to every git command the executor runs, so commits made by a rebase or
+// merge while retrying a push are signed too.
+var signing SigningConfig
+
+// allowedSignersTemp is the allowed signers file written for --sign ssh when none is
+// given, removed when the run ends.
+var allowedSignersTemp string
+
+// defaultRemoteURL is the origin of the --repo repository unless --remote is given.
+const defaultRemoteURL = "https://github.com/airitech-soe/csv-go-git-ops.git"
+
+func main() {
+	var repoPath, scenarioPath, logPath, githubUsername, githubToken string
+	var reportPath, junitPath, reposPath, remoteURL string
+	var options ExecutionOptions
+	var onError string
+	var opsPerSecond, pushesPerMinute float64
+	var cloneIfMissing, ephemeral, skipPreflight, forceUnlock bool
+	var expectedBranch string
+	
+	flag.StringVar(&repoPath, "repo", "", "Path to git repository (used by rows without a repo column)")
+	flag.StringVar(&remoteURL, "remote", defaultRemoteURL, "Origin URL of the --repo repository (for example a local bare repository in tests)")
+	flag.StringVar(&reposPath, "repos", "", "YAML/JSON file mapping repo column names to local clones and remotes (optional)")
+	flag.StringVar(&scenarioPath, "scenario", "", "Path to scenario CSV file")
+	flag.StringVar(&logPath, "log", "execution_o.log", "Path to log file")
+	flag.StringVar(&githubUsername, "username", "", "GitHub username")
+	flag.StringVar(&githubToken, "token", "", "GitHub personal access token")
+	flag.StringVar(&reportPath, "report", "", "Path to write the JSON execution report (optional)")
+	flag.StringVar(&junitPath, "junit", "", "Path to write the JUnit XML execution report (optional)")
+	flag.StringVar(&options.SyncStrategy, "sync", "rebase", "How to integrate remote changes when a push is rejected: rebase or merge")
+	flag.IntVar(&options.PushRetries, "push-retries", 3, "Number of times to re-sync and retry a rejected push")
+	flag.DurationVar(&options.PushBackoff, "push-backoff", 2*time.Second, "Initial wait between push retries (doubled each retry)")
+	flag.IntVar(&options.Retry.MaxAttempts, "retry-attempts", 3, "Maximum attempts for pull/fetch/push on transient failures")
+	flag.DurationVar(&options.Retry.InitialBackoff, "retry-backoff", time.Second, "Initial wait before retrying a transient failure")
+	flag.DurationVar(&options.Retry.MaxBackoff, "retry-max-backoff", 30*time.Second, "Upper bound for the wait between transient retries")
+	flag.Float64Var(&options.Retry.Jitter, "retry-jitter", 0.2, "Random jitter applied to retry waits, as a fraction (0..1)")
+	flag.StringVar(&onError, "on-error", "continue", "What to do when a line fails: stop, continue or abort-after=N")
+	flag.BoolVar(&options.Atomic, "atomic", false, "Run the whole scenario on a temporary branch and push only if every line succeeds")
+	flag.IntVar(&options.Parallel, "parallel", 1, "Number of repositories to run at the same time (rows of one repository always run in order)")
+	flag.Float64Var(&opsPerSecond, "ops-per-second", 10, "Maximum operations started per second across all repositories (0 = no limit)")
+	flag.Float64Var(&pushesPerMinute, "pushes-per-minute", 0, "Maximum pushes per minute, including retries (0 = no limit)")
+	flag.BoolVar(&cloneIfMissing, "clone-if-missing", false, "Clone the remote into --repo (or a --repos path) when it does not exist yet, and keep it")
+	flag.BoolVar(&ephemeral, "ephemeral", false, "Clone every repository into a temporary directory, run there and remove it afterwards; --repo is not touched")
+	flag.StringVar(&expectedBranch, "branch", "", "Branch every repository must be on before the run starts (default: any branch)")
+	flag.BoolVar(&forceUnlock, "force-unlock", false, "Remove a repository lock left by another executor run, even if it looks alive")
+	flag.BoolVar(&skipPreflight, "skip-preflight", false, "Skip the worktree, branch, upstream and remote checks before the run")
+	flag.StringVar(&signing.Format, "sign", "", "Sign every commit: gpg or ssh (default: no signing)")
+	flag.StringVar(&signing.Key, "signing-key", "", "GPG key ID, or SSH key file, to sign with (default for gpg: git's user.signingkey or the committer's key)")
+	flag.StringVar(&options.Provenance, "provenance", "", "Link commits to their scenario lines: trailers (in the commit message) or notes (in refs/notes/scenario) (default: neither)")
+	flag.StringVar(&options.RunID, "run-id", "", "Run ID recorded in trailers, notes and the report (default: generated from the start time)")
+	flag.StringVar(&signing.AllowedSigners, "allowed-signers", "", "SSH allowed signers file for verifying signatures (default: trust only --signing-key)")
+	flag.Float64Var(&options.ReplaySpeed, "replay-speed", 0, "Space operations by their scenario time column, this many times faster than real time (0 = off)")
+	flag.Parse()
+	
+	if (repoPath == "" && reposPath == "") || scenarioPath == "" || githubUsername == "" || githubToken == "" {
+		fmt.Println("Usage: git_scenario_execute --repo /path/to/repo [--remote url] [--repos repos.yaml] --scenario /path/to/scenario.csv --username <github_username> --token <github_token> [--log /path/to/log] [--report report.json] [--junit report.xml] [--on-error stop|continue|abort-after=N] [--parallel N] [--clone-if-missing|--ephemeral] [--branch name] [--skip-preflight] [--force-unlock] [--sign gpg|ssh --signing-key key]")
+		os.Exit(exitFatal)
+	}
+	
+	if options.SyncStrategy != "rebase" && options.SyncStrategy != "merge" {
+		fmt.Printf("Invalid --sync value %q: must be 'rebase' or 'merge'\n", options.SyncStrategy)
+		os.Exit(exitFatal)
+	}
+	
+	if signing.Format != "" && signing.Format != "gpg" && signing.Format != "ssh" {
+		fmt.Printf("Invalid --sign value %q: must be 'gpg' or 'ssh'\n", signing.Format)
+		os.Exit(exitFatal)
+	}
+	if signing.Format == "ssh" && signing.Key == "" {
+		fmt.Println("--sign ssh needs --signing-key")
+		os.Exit(exitFatal)
+	}
+	
+	if options.Provenance != "" && options.Provenance != "trailers" && options.Provenance != "notes" {
+		fmt.Printf("Invalid --provenance value %q: must be 'trailers' or 'notes'\n", options.Provenance)
+		os.Exit(exitFatal)
+	}
+	if options.RunID == "" {
+		options.RunID = newRunID()
+	}
+	
+	if options.Parallel < 1 {
+		fmt.Printf("Invalid --parallel value %d: must be at least 1\n", options.Parallel)
+		os.Exit(exitFatal)
+	}
+	
+	if opsPerSecond < 0 || pushesPerMinute < 0 || options.ReplaySpeed < 0 {
+		fmt.Println("Invalid pacing: --ops-per-second, --pushes-per-minute and --replay-speed must not be negative")
+		os.Exit(exitFatal)
+	}
+	options.OpPacing.Interval = perUnit(opsPerSecond, time.Second)
+	options.PushPacing.Interval = perUnit(pushesPerMinute, time.Minute)
+	
+	policy, err := parseFailurePolicy(onError)
+	if err != nil {
+		fmt.Printf("Invalid --on-error value: %v\n", err)
+		os.Exit(exitFatal)
+	}
+	options.OnError = policy
+	
+	// Setup logging
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		fmt.Printf("Error opening log file: %v\n", err)
+		os.Exit(exitFatal)
+	}
+	defer logFile.Close()
+	
+	logger := log.New(logFile, "", 0)
+	
+	// Log execution start
+	logger.Printf("[%s] === Scenario execution started ===", time.Now().Format("2006-01-02 15:04:05"))
+	logger.Printf("[%s] Repository: %s", time.Now().Format("2006-01-02 15:04:05"), repoPath)
+	logger.Printf("[%s] Scenario file: %s", time.Now().Format("2006-01-02 15:04:05"), scenarioPath)
+	logger.Printf("[%s] GitHub username: %s", time.Now().Format("2006-01-02 15:04:05"), githubUsername)
+	
+	// Read scenario CSV
+	operations, err := readScenario(scenarioPath)
+	if err != nil {
+		logger.Printf("[%s] ERROR: Failed to read scenario file: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+		fmt.Printf("Error reading scenario file: %v\n", err)
+		os.Exit(exitFatal)
+	}
+	
+	logger.Printf("[%s] Total operations to execute: %d", time.Now().Format("2006-01-02 15:04:05"), len(operations))
+	
+	// Remember where we started so report paths don't end up inside the repository
+	startDir, err := os.Getwd()
+	if err != nil {
+		fmt.Printf("Error getting working directory: %v\n", err)
+		os.Exit(exitFatal)
+	}
+	
+	repos := map[string]RepositoryConfig{}
+	if reposPath != "" {
+		repos, err = readRepositoryMap(reposPath)
+		if err != nil {
+			logger.Printf("[%s] ERROR: Failed to read repository map: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+			fmt.Printf("Error reading repository map: %v\n", err)
+			os.Exit(exitFatal)
+		}
+	}
+	
+	batches, err := groupByRepository(operations, repoPath, remoteURL, repos)
+	if err != nil {
+		logger.Printf("[%s] ERROR: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitFatal)
+	}
+	
+	// Prepare every repository before the first row runs, so a bad path or credential
+	// setup fails the run without leaving some repositories changed
+	for _, batch := range batches {
+		if err := prepareWorkspace(batch, ephemeral, cloneIfMissing, githubUsername, githubToken, logger); err != nil {
+			logger.Printf("[%s] ERROR: Failed to prepare %s: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+			fmt.Printf("Error preparing %s: %v\n", batch.Name, err)
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+		if info, err := os.Stat(batch.Path); err != nil || !info.IsDir() {
+			logger.Printf("[%s] ERROR: Repository directory %s is not usable: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Path, err)
+			fmt.Printf("Error: repository directory %s is not usable\n", batch.Path)
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+		
+		// Hold the lock from before the credentials are written until the run ends
+		if err := acquireLock(batch.Path, scenarioPath, forceUnlock, logger); err != nil {
+			logger.Printf("[%s] ERROR: %s: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+			fmt.Printf("Error: %s: %v\n", batch.Name, err)
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+		
+		// Configure git credentials in the repository
+		err = configureGitCredentials(batch.Path, githubUsername, githubToken, batch.Remote, logger)
+		if err != nil {
+			logger.Printf("[%s] ERROR: Failed to configure git credentials for %s: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+			fmt.Printf("Error configuring git credentials: %v\n", err)
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+	}
+	
+	if signing.Format == "ssh" && signing.AllowedSigners == "" {
+		if err := writeAllowedSigners(); err != nil {
+			logger.Printf("[%s] ERROR: Failed to prepare SSH signature verification: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+			fmt.Printf("Error preparing SSH signature verification: %v\n", err)
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+	}
+	
+	// Fail before the first row if any repository is not safe to run in, listing every
+	// problem at once rather than making the user fix them one run at a time
+	if !skipPreflight {
+		failed := false
+		for _, batch := range batches {
+			for _, problem := range preflight(batch.Path, expectedBranch, logger, options.Retry) {
+				logger.Printf("[%s] ERROR: Preflight failed for %s: %s", time.Now().Format("2006-01-02 15:04:05"), batch.Name, problem)
+				fmt.Printf("Preflight failed for %s: %s\n", batch.Name, problem)
+				failed = true
+			}
+		}
+		if failed {
+			fmt.Println("No scenario line was executed. Fix the problems above or pass --skip-preflight.")
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+		logger.Printf("[%s] Preflight checks passed", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	
+	report := ExecutionReport{
+		Executor:   "create-update",
+		Repository: repoPath,
+		Scenario:   scenarioPath,
+		StartedAt:  time.Now(),
+		Total:      len(operations),
+		Atomic:     options.Atomic,
+		Parallel:   options.Parallel,
+		Signing:    signing.Format,
+		RunID:      options.RunID,
+	}
+	
+	if options.Atomic {
+		// One failure rolls everything back, so there is no point in running the rest
+		options.OnError = FailurePolicy{Mode: "stop", MaxFailures: 1}
+		onError = "stop"
+	}
+	
+	if options.ReplaySpeed > 0 {
+		for _, op := range operations {
+			if !op.Time.IsZero() && (options.replayBase.IsZero() || op.Time.Before(options.replayBase)) {
+				options.replayBase = op.Time
+			}
+		}
+		if options.replayBase.IsZero() {
+			logger.Printf("[%s] ERROR: --replay-speed needs a time column in the scenario", time.Now().Format("2006-01-02 15:04:05"))
+			fmt.Println("Error: --replay-speed needs a time column in the scenario")
+			cleanupWorkspaces()
+			os.Exit(exitFatal)
+		}
+		options.replayStart = time.Now()
+		logger.Printf("[%s] Replaying from %s at %gx speed", time.Now().Format("2006-01-02 15:04:05"), options.replayBase.Format(time.RFC3339), options.ReplaySpeed)
+	}
+	
+	// Execute operations, up to --parallel repositories at a time. A repository's rows
+	// always run in order on one worker; batches start in the order they first appear.
+	progress := &RunProgress{}
+	queue := make(chan *RepositoryBatch)
+	var workers sync.WaitGroup
+	for w := 0; w < options.Parallel && w < len(batches); w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for batch := range queue {
+				batchLogger := logger
+				if options.Parallel > 1 {
+					batchLogger = log.New(logFile, "["+batch.Name+"] ", 0)
+				}
+				runBatch(batch, batchLogger, scenarioPath, &options, onError, progress)
+			}
+		}()
+	}
+	for _, batch := range batches {
+		queue <- batch
+	}
+	close(queue)
+	workers.Wait()
+	
+	// Results are reported in batch order, whatever order the workers finished in
+	for _, batch := range batches {
+		report.Results = append(report.Results, batch.Results...)
+	}
+	successCount, failureCount := progress.Succeeded, progress.Failed
+	
+	fatal := false
+	if options.Atomic {
+		// Publish only when every repository succeeded. A push that fails after other
+		// repositories were published cannot undo those; they are reported as published.
+		published := map[string]bool{}
+		if failureCount == 0 {
+			for _, batch := range batches {
+				if err := batch.Run.finish(batch.Path, logger, scenarioPath, &options); err != nil {
+					logger.Printf("[%s] ERROR: Failed to publish atomic run in %s: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+					fmt.Printf("Error publishing atomic run in %s: %v\n", batch.Name, err)
+					failureCount++
+					fatal = true
+					break
+				}
+				published[batch.Name] = true
+			}
+		}
+		if failureCount > 0 {
+			for _, batch := range batches {
+				if batch.Run == nil || published[batch.Name] {
+					continue
+				}
+				rolledBack, err := batch.Run.rollback(batch.Path, logger, scenarioPath)
+				if err != nil {
+					logger.Printf("[%s] ERROR: Rollback of %s failed, repository may need manual cleanup: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+					fmt.Printf("Error rolling back %s: %v\n", batch.Name, err)
+					fatal = true
+				}
+				report.RolledBack = append(report.RolledBack, rolledBack...)
+				for i := range report.Results {
+					if report.Results[i].Repository == batch.Name && report.Results[i].Status == "success" {
+						report.Results[i].Status = "rolled_back"
+						report.Results[i].Error = "rolled back: the atomic run did not complete"
+						report.Results[i].CommitSHA = ""
+						successCount--
+					}
+				}
+				fmt.Printf("Atomic run rolled back %d commit(s) in %s to %s\n", len(rolledBack), batch.Name, batch.Run.BaseCommit)
+			}
+			for name := range published {
+				logger.Printf("[%s] WARNING: %s was already published and is not rolled back", time.Now().Format("2006-01-02 15:04:05"), name)
+				fmt.Printf("Warning: %s was already published and is not rolled back\n", name)
+			}
+		}
+	}
+	
+	// Check the signature of every commit the run kept, so the report shows which commits
+	// a branch that requires signed commits would refuse
+	if signing.Format != "" {
+		signed, commits := 0, 0
+		i := 0
+		for _, batch := range batches {
+			for range batch.Results {
+				r := &report.Results[i]
+				i++
+				if r.CommitSHA == "" {
+					continue
+				}
+				commits++
+				r.Signature, r.Signer = verifyCommitSignature(batch.Path, r.CommitSHA)
+				if r.Signature == "good" {
+					signed++
+				} else {
+					logger.Printf("[%s] WARNING: Commit %s (line %d) signature is %s", time.Now().Format("2006-01-02 15:04:05"), r.CommitSHA, r.LineNumber, r.Signature)
+				}
+			}
+		}
+		logger.Printf("[%s] Signatures: %d of %d commit(s) verified", time.Now().Format("2006-01-02 15:04:05"), signed, commits)
+		fmt.Printf("Signatures: %d of %d commit(s) verified\n", signed, commits)
+	}
+	
+	// Notes are written once the commits are final, after any rebase or atomic publish
+	if options.Provenance == "notes" {
+		i := 0
+		for _, batch := range batches {
+			results := report.Results[i : i+len(batch.Results)]
+			i += len(batch.Results)
+			if err := writeProvenanceNotes(batch.Path, results, logger, scenarioPath, &options); err != nil {
+				logger.Printf("[%s] ERROR: Failed to write provenance notes in %s: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+				fmt.Printf("Error writing provenance notes in %s: %v\n", batch.Name, err)
+				fatal = true
+			}
+		}
+	}
+	
+	if len(batches) > 1 {
+		report.Repositories = summarizeRepositories(batches, report.Results)
+	}
+	
+	report.FinishedAt = time.Now()
+	report.Succeeded = successCount
+	report.Failed = 0
+	for _, r := range report.Results {
+		if r.Status == "failed" {
+			report.Failed++
+		}
+	}
+	report.Skipped = len(operations) - successCount - report.Failed
+	
+	logger.Printf("[%s] === Scenario execution completed ===", time.Now().Format("2006-01-02 15:04:05"))
+	logger.Printf("[%s] Success: %d/%d operations", time.Now().Format("2006-01-02 15:04:05"), successCount, len(operations))
+	
+	// Report paths are relative to where the executor was started, not the repository
+	if reportPath != "" {
+		if err := writeJSONReport(resolveOutputPath(reportPath, startDir), report); err != nil {
+			logger.Printf("[%s] ERROR: Failed to write JSON report: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+			fmt.Printf("Error writing JSON report: %v\n", err)
+		}
+	}
+	if junitPath != "" {
+		if err := writeJUnitReport(resolveOutputPath(junitPath, startDir), report); err != nil {
+			logger.Printf("[%s] ERROR: Failed to write JUnit report: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+			fmt.Printf("Error writing JUnit report: %v\n", err)
+		}
+	}
+	
+	fmt.Printf("Execution completed. Success: %d/%d operations\n", successCount, len(operations))
+	fmt.Printf("Check log file for details: %s\n", logPath)
+	
+	cleanupWorkspaces()
+	if fatal {
+		logFile.Close()
+		os.Exit(exitFatal)
+	}
+	if failureCount > 0 || successCount < len(operations) {
+		logFile.Close()
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// readScenario picks the scenario format from the file extension: .yaml, .yml and .json
+// are documents, anything else is CSV.
+func readScenario(filename string) ([]ScenarioOperation, error) {
+	if !isScenarioDocument(filename) {
+		return readScenarioCSV(filename)
+	}
+	
+	documentOps, err := readScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+	
+	var operations []ScenarioOperation
+	for _, d := range documentOps {
+		switch d.Op {
+		case "create", "update", "delete", "move":
+		default:
+			return nil, fmt.Errorf("invalid operation type '%s' at %s: must be 'create', 'update', 'delete' or 'move'", d.Op, d.Origin)
+		}
+		if d.Op == "move" && d.Target == "" {
+			return nil, fmt.Errorf("move operation at %s needs a target", d.Origin)
+		}
+		opTime, err := parseScenarioTime(d.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time at %s: %v", d.Origin, err)
+		}
+		operations = append(operations, ScenarioOperation{
+			FilePath:      d.Path,
+			OperationType: d.Op,
+			CommitMessage: d.Message,
+			FileContent:   d.Content,
+			Author:        d.Author,
+			TargetPath:    d.Target,
+			LineNumber:    d.Line,
+			Origin:        d.Origin,
+			Repository:    d.Repo,
+			Time:          opTime,
+		})
+	}
+	return operations, nil
+}
+
+func readScenarioCSV(filename string) ([]ScenarioOperation, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	
+	reader := csv.NewReader(file)
+	// Make CSV parsing more flexible
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+	reader.TrimLeadingSpace = true
+	
+	var operations []ScenarioOperation
+	var positions []int
+	headerChecked := false
+	version := 1
+	
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV parsing error: %v", err)
+		}
+		// The line the record starts on, counting blank lines and the lines of
+		// multi-line fields
+		lineNumber, _ := reader.FieldPos(0)
+		
+		// Skip empty lines
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+		
+		// The first non-empty rows may be a format marker and a header naming the columns
+		if !headerChecked {
+			if version == 1 {
+				v, isMarker, err := parseFormatMarker(record)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				if isMarker {
+					version = v
+					continue
+				}
+			}
+			headerChecked = true
+			var isHeader bool
+			positions, isHeader, err = parseHeader(record)
+			if err != nil {
+				return nil, fmt.Errorf("invalid header at line %d: %v", lineNumber, err)
+			}
+			if isHeader {
+				continue
+			}
+			if version >= 2 {
+				return nil, fmt.Errorf("scenario format %d requires a header row at line %d", version, lineNumber)
+			}
+		}
+		if positions != nil {
+			record = reorderRecord(record, positions)
+		}
+		
+		// Validate minimum required fields
+		if len(record) < 3 {
+			return nil, fmt.Errorf("invalid CSV format at line %d: expected at least 3 columns, got %d columns. Record: %v", lineNumber, len(record), record)
+		}
+		
+		// Trim whitespace from all fields
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+		
+		op := ScenarioOperation{
+			FilePath:      record[0],
+			OperationType: record[1],
+			CommitMessage: record[2],
+			LineNumber:    lineNumber,
+		}
+		
+		// Validate operation type
+		switch op.OperationType {
+		case "create", "update", "delete", "move":
+		default:
+			return nil, fmt.Errorf("invalid operation type '%s' at line %d: must be 'create', 'update', 'delete' or 'move'", op.OperationType, lineNumber)
+		}
+		
+		// Add file content if available (for create and update operations)
+		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+			op.FileContent = record[3]
+		} else if op.OperationType == "update" && version < 2 {
+			// Format version 1 filled updates without content with a placeholder
+			op.FileContent = "test data"
+		}
+		
+		// "@file:<path>" loads the content from a file next to the scenario, keeping
+		// whitespace and newlines that CSV trimming would otherwise lose
+		if strings.HasPrefix(op.FileContent, "@file:") {
+			contentPath := strings.TrimPrefix(op.FileContent, "@file:")
+			if !filepath.IsAbs(contentPath) {
+				contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+			}
+			content, err := os.ReadFile(contentPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read content reference at line %d: %v", lineNumber, err)
+			}
+			op.FileContent = string(content)
+		}
+		
+		// Optional author, move target and repository columns
+		if len(record) > 4 {
+			op.Author = record[4]
+		}
+		if len(record) > 5 {
+			op.TargetPath = record[5]
+		}
+		if len(record) > 6 {
+			op.Repository = record[6]
+		}
+		if len(record) > 7 {
+			if op.Time, err = parseScenarioTime(record[7]); err != nil {
+				return nil, fmt.Errorf("invalid time at line %d: %v", lineNumber, err)
+			}
+		}
+		if op.OperationType == "move" && op.TargetPath == "" {
+			return nil, fmt.Errorf("move operation at line %d needs a target path in column 6", lineNumber)
+		}
+		
+		operations = append(operations, op)
+	}
+	
+	return operations, nil
+}
+
+// parseScenarioTime reads the optional time column. Empty means the operation has no time.
+func parseScenarioTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ScenarioDocument is the YAML/JSON form of a scenario. Operations map onto the CSV
+// columns; content is taken verbatim, so multi-line content needs no "@file:" reference.
+// Vars are defaults for "${name}" placeholders and can be overridden by an include.
+type ScenarioDocument struct {
+	Format     int                 `json:"format,omitempty" yaml:"format,omitempty"`
+	Vars       map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Operations []DocumentOperation `json:"operations" yaml:"operations"`
+}
+
+// DocumentOperation is one entry of a ScenarioDocument: an operation, an include of
+// another document, or a for loop over Do. Expansion leaves only operations.
+type DocumentOperation struct {
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	Op          string `json:"op,omitempty" yaml:"op,omitempty"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+	Content     string `json:"content,omitempty" yaml:"content,omitempty"`
+	ContentFile string `json:"content_file,omitempty" yaml:"content_file,omitempty"` // relative to the scenario
+	Author      string `json:"author,omitempty" yaml:"author,omitempty"`
+	Target      string `json:"target,omitempty" yaml:"target,omitempty"`
+	Repo        string `json:"repo,omitempty" yaml:"repo,omitempty"` // repository name or path, for multi-repository runs
+	Time        string `json:"time,omitempty" yaml:"time,omitempty"` // RFC 3339 time of the operation, for time-scaled replay
+
+	Include string              `json:"include,omitempty" yaml:"include,omitempty"` // document to splice in, relative to this one
+	Vars    map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`       // extra variables for the include or loop body
+	For     string              `json:"for,omitempty" yaml:"for,omitempty"`         // loop variable name
+	In      []string            `json:"in,omitempty" yaml:"in,omitempty"`           // values to loop over
+	Range   string              `json:"range,omitempty" yaml:"range,omitempty"`     // or an integer range "first..last"
+	Pad     int                 `json:"pad,omitempty" yaml:"pad,omitempty"`         // zero-pad range values to this width
+	Do      []DocumentOperation `json:"do,omitempty" yaml:"do,omitempty"`
+
+	Line   int    `json:"-" yaml:"-"`
+	Origin string `json:"-" yaml:"-"` // file:line and loop values the operation was expanded from
+}
+
+// placeholder matches "${name}", and "$${name}", which stands for a literal "${name}".
+var placeholder = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isScenarioDocument reports whether the file extension selects the YAML or JSON format.
+func isScenarioDocument(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readScenarioDocument loads a YAML or JSON scenario and expands its includes, loops and
+// variables. Each operation keeps the line it was written on and an Origin naming the
+// file and loop values, and content_file references are read into Content.
+func readScenarioDocument(filename string) ([]DocumentOperation, error) {
+	return expandDocument(filename, nil, "", nil)
+}
+
+func expandDocument(filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, included := range stack {
+		if included == abs {
+			return nil, fmt.Errorf("include cycle: %s is already being expanded", filename)
+		}
+	}
+
+	doc, err := loadScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables passed by an include win over the document's defaults
+	scope := make(map[string]string)
+	for name, value := range doc.Vars {
+		scope[name] = value
+	}
+	for name, value := range vars {
+		scope[name] = value
+	}
+	return expandItems(doc.Operations, filename, scope, bindings, append(stack, abs))
+}
+
+func expandItems(items []DocumentOperation, filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	var ops []DocumentOperation
+	for _, item := range items {
+		where := fmt.Sprintf("%s:%d", filename, item.Line)
+		scope, err := withVars(vars, item.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+
+		switch {
+		case item.Include != "" && item.For != "":
+			return nil, fmt.Errorf("%s: an entry cannot be both an include and a for loop", where)
+		case item.Include != "" || item.For != "":
+			if item.Path != "" || item.Op != "" {
+				return nil, fmt.Errorf("%s: include and for entries cannot also be operations", where)
+			}
+		}
+
+		switch {
+		case item.Include != "":
+			name, err := substitute(item.Include, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(filename), name)
+			}
+			included, err := expandDocument(name, scope, bindings, stack)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			ops = append(ops, included...)
+
+		case item.For != "":
+			values, err := loopValues(item, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			for _, value := range values {
+				body := make(map[string]string, len(scope)+1)
+				for name, v := range scope {
+					body[name] = v
+				}
+				body[item.For] = value
+				expanded, err := expandItems(item.Do, filename, body, fmt.Sprintf("%s %s=%s", bindings, item.For, value), stack)
+				if err != nil {
+					return nil, err
+				}
+				ops = append(ops, expanded...)
+			}
+
+		default:
+			op, err := expandOperation(item, filename, scope, stack[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			op.Origin = where
+			if bindings != "" {
+				op.Origin += " [" + strings.TrimSpace(bindings) + "]"
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// expandOperation fills in the placeholders of one operation and loads its content_file.
+// The content_file reference is rewritten relative to the top-level document.
+func expandOperation(item DocumentOperation, filename string, vars map[string]string, topLevel string) (DocumentOperation, error) {
+	op := DocumentOperation{Line: item.Line}
+	fields := []struct {
+		from string
+		to   *string
+	}{
+		{item.Path, &op.Path}, {item.Op, &op.Op}, {item.Message, &op.Message}, {item.Content, &op.Content},
+		{item.ContentFile, &op.ContentFile}, {item.Author, &op.Author}, {item.Target, &op.Target}, {item.Repo, &op.Repo}, {item.Time, &op.Time},
+	}
+	for _, field := range fields {
+		value, err := substitute(field.from, vars)
+		if err != nil {
+			return op, err
+		}
+		*field.to = value
+	}
+
+	if op.Path == "" || op.Op == "" {
+		return op, fmt.Errorf("operation needs a path and an op")
+	}
+	if op.ContentFile == "" {
+		return op, nil
+	}
+	if op.Content != "" {
+		return op, fmt.Errorf("operation has both content and content_file")
+	}
+	contentPath := op.ContentFile
+	if !filepath.IsAbs(contentPath) {
+		contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+		if abs, err := filepath.Abs(contentPath); err == nil {
+			if rel, err := filepath.Rel(filepath.Dir(topLevel), abs); err == nil {
+				op.ContentFile = filepath.ToSlash(rel)
+			}
+		}
+	}
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		return op, fmt.Errorf("failed to read content_file: %v", err)
+	}
+	op.Content = string(content)
+	return op, nil
+}
+
+// withVars returns vars extended by extra, whose values may use the variables in vars.
+func withVars(vars, extra map[string]string) (map[string]string, error) {
+	if len(extra) == 0 {
+		return vars, nil
+	}
+	scope := make(map[string]string, len(vars)+len(extra))
+	for name, value := range vars {
+		scope[name] = value
+	}
+	for name, value := range extra {
+		expanded, err := substitute(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		scope[name] = expanded
+	}
+	return scope, nil
+}
+
+// loopValues returns the values of a for loop: the "in" list, or the "range" first..last
+// zero-padded to "pad" digits.
+func loopValues(item DocumentOperation, vars map[string]string) ([]string, error) {
+	if (len(item.In) > 0) == (item.Range != "") {
+		return nil, fmt.Errorf("for %s needs exactly one of \"in\" and \"range\"", item.For)
+	}
+
+	var values []string
+	for _, v := range item.In {
+		value, err := substitute(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if item.Range == "" {
+		return values, nil
+	}
+
+	bounds, err := substitute(item.Range, vars)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(bounds, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("range must look like <first>..<last>, got %q", bounds)
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	last, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || last < first {
+		return nil, fmt.Errorf("invalid range %q", bounds)
+	}
+	for n := first; n <= last; n++ {
+		values = append(values, fmt.Sprintf("%0*d", item.Pad, n))
+	}
+	return values, nil
+}
+
+// substitute replaces "${name}" placeholders; an undefined variable is an error.
+// "$${name}" is kept as a literal "${name}".
+func substitute(s string, vars map[string]string) (string, error) {
+	var missing []string
+	result := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable ${%s}", missing[0])
+	}
+	return result, nil
+}
+
+// loadScenarioDocument decodes one YAML or JSON file, rejecting unknown fields, and
+// records the line every entry starts on.
+func loadScenarioDocument(filename string) (ScenarioDocument, error) {
+	var doc ScenarioDocument
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return doc, err
+	}
+
+	isJSON := strings.ToLower(filepath.Ext(filename)) == ".json"
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid JSON scenario %s: %v", filename, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid YAML scenario %s: %v", filename, err)
+		}
+	}
+	if doc.Format != 0 && doc.Format != currentFormatVersion {
+		return doc, fmt.Errorf("unsupported scenario format %d in %s (YAML and JSON scenarios use format %d)", doc.Format, filename, currentFormatVersion)
+	}
+
+	// JSON is read through the YAML parser too, just for line numbers; if that fails
+	// (e.g. tab indentation) only top-level entries get exact lines
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err == nil && root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		assignLines(doc.Operations, mappingValue(root.Content[0], "operations"), 0)
+	} else if isJSON {
+		for i, line := range jsonOperationLines(data) {
+			if i < len(doc.Operations) {
+				assignLines(doc.Operations[i:i+1], nil, line)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// assignLines copies the line of every sequence element onto items, recursing into
+// "do"; without a node the items inherit parentLine.
+func assignLines(items []DocumentOperation, seq *yaml.Node, parentLine int) {
+	for i := range items {
+		items[i].Line = parentLine
+		var node *yaml.Node
+		if seq != nil && seq.Kind == yaml.SequenceNode && i < len(seq.Content) {
+			node = seq.Content[i]
+			items[i].Line = node.Line
+		}
+		assignLines(items[i].Do, mappingValue(node, "do"), items[i].Line)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// jsonOperationLines returns the line each element of the top-level "operations" array starts on.
+func jsonOperationLines(data []byte) []int {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		var skip json.RawMessage
+		if key != "operations" {
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+			continue
+		}
+		if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil
+		}
+		var lines []int
+		for decoder.More() {
+			// InputOffset is just past the previous token; skip to the element itself
+			offset := int(decoder.InputOffset())
+			for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+				offset++
+			}
+			lines = append(lines, 1+bytes.Count(data[:offset], []byte("\n")))
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+// currentFormatVersion is the scenario format written by the tools in this repository.
+// Version 1 is the original headerless layout; version 2 starts with a
+// "#scenario-format: 2" line followed by a header row, and an update without content
+// writes an empty file instead of the "test data" placeholder.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
+
+// parseFormatMarker reports whether record is a "#scenario-format: N" line and returns N.
+func parseFormatMarker(record []string) (int, bool, error) {
+	if len(record) != 1 || !strings.HasPrefix(strings.TrimSpace(record[0]), formatMarker) {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), formatMarker)))
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid format marker %q", record[0])
+	}
+	if version > currentFormatVersion {
+		return version, true, fmt.Errorf("scenario format %d is newer than this tool supports (%d)", version, currentFormatVersion)
+	}
+	return version, true, nil
+}
+
+// scenarioColumns is the legacy positional layout. A header row may name these columns
+// in any order; files without one keep using the positions.
+var scenarioColumns = []string{"path", "op", "message", "content", "author", "target", "repo", "time"}
+
+// columnAliases are alternative header spellings.
+var columnAliases = map[string]string{
+	"operation":   "op",
+	"file":        "path",
+	"commit":      "message",
+	"target_path": "target",
+	"repository":  "repo",
+}
+
+// parseHeader reports whether record is a header row (it names both "path" and "op") and
+// returns, for every entry of scenarioColumns, the index it appears at or -1. Unknown
+// column names are an error so that a typo does not silently drop data; columns starting
+// with "x-" are free-form and ignored.
+func parseHeader(record []string) ([]int, bool, error) {
+	names := make([]string, len(record))
+	isHeader := map[string]bool{}
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		names[i] = name
+		isHeader[name] = true
+	}
+	if !isHeader["path"] || !isHeader["op"] {
+		return nil, false, nil
+	}
+
+	positions := make([]int, len(scenarioColumns))
+	for i := range positions {
+		positions[i] = -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		column := -1
+		for j, known := range scenarioColumns {
+			if name == known {
+				column = j
+			}
+		}
+		if column < 0 {
+			return nil, true, fmt.Errorf("unknown column %q in header (known: %s; prefix custom columns with x-)", record[i], strings.Join(scenarioColumns, ", "))
+		}
+		if positions[column] >= 0 {
+			return nil, true, fmt.Errorf("column %q appears more than once in header", name)
+		}
+		positions[column] = i
+	}
+	if positions[2] < 0 {
+		return nil, true, fmt.Errorf("header has no %q column", "message")
+	}
+	return positions, true, nil
+}
+
+// reorderRecord returns record in the legacy positional layout described by positions.
+func reorderRecord(record []string, positions []int) []string {
+	var reordered []string
+	for column, index := range positions {
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		for len(reordered) < column {
+			reordered = append(reordered, "")
+		}
+		reordered = append(reordered, record[index])
+	}
+	return reordered
+}
+
+// readRepositoryMap loads the --repos file: a YAML or JSON object from repository name to
+// its path (relative to the map file) and optional remote.
+func readRepositoryMap(filename string) (map[string]RepositoryConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	repos := map[string]RepositoryConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&repos); err != nil {
+		return nil, fmt.Errorf("invalid repository map %s: %v", filename, err)
+	}
+	for name, repo := range repos {
+		if repo.Path == "" {
+			return nil, fmt.Errorf("repository %q in %s has no path", name, filename)
+		}
+		if !filepath.IsAbs(repo.Path) {
+			repo.Path = filepath.Join(filepath.Dir(filename), repo.Path)
+			repos[name] = repo
+		}
+	}
+	return repos, nil
+}
+
+// groupByRepository splits the operations into one batch per repository, keeping the
+// scenario order inside each batch and ordering batches by first appearance. A repo
+// value is looked up in repos first and otherwise taken as a path.
+func groupByRepository(operations []ScenarioOperation, defaultRepo, defaultRemote string, repos map[string]RepositoryConfig) ([]*RepositoryBatch, error) {
+	var batches []*RepositoryBatch
+	byPath := map[string]*RepositoryBatch{}
+	for _, op := range operations {
+		name, repoPath, remote := op.Repository, op.Repository, ""
+		if config, ok := repos[op.Repository]; ok {
+			repoPath, remote = config.Path, config.Remote
+		} else if op.Repository == "" {
+			if defaultRepo == "" {
+				return nil, fmt.Errorf("line %d has no repo and --repo is not set", op.LineNumber)
+			}
+			name, repoPath, remote = defaultRepo, defaultRepo, defaultRemote
+		}
+		
+		abs, err := filepath.Abs(repoPath)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid repository path %q: %v", op.LineNumber, repoPath, err)
+		}
+		batch, ok := byPath[abs]
+		if !ok {
+			batch = &RepositoryBatch{Name: name, Path: abs, Remote: remote}
+			byPath[abs] = batch
+			batches = append(batches, batch)
+		}
+		batch.Operations = append(batch.Operations, op)
+	}
+	return batches, nil
+}
+
+// ephemeralClones are the temporary directories created by --ephemeral, removed when the
+// run ends however it ends.
+var ephemeralClones []string
+
+// prepareWorkspace makes sure the batch has a local clone to run in. With ephemeral, the
+// batch is moved to a fresh temporary clone of its remote; with cloneIfMissing, a missing
+// path is cloned from the remote and kept for later runs.
+func prepareWorkspace(batch *RepositoryBatch, ephemeral, cloneIfMissing bool, username, token string, logger *log.Logger) error {
+	if !ephemeral {
+		if _, err := os.Stat(batch.Path); !cloneIfMissing || !os.IsNotExist(err) {
+			return nil
+		}
+	}
+	if batch.Remote == "" {
+		return fmt.Errorf("no remote to clone from; set one in --repos")
+	}
+	
+	dir := batch.Path
+	if ephemeral {
+		tmp, err := os.MkdirTemp("", "scenario-workspace-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary workspace: %v", err)
+		}
+		ephemeralClones = append(ephemeralClones, tmp)
+		dir = filepath.Join(tmp, filepath.Base(batch.Path))
+	} else if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(dir), err)
+	}
+	
+	if err := cloneRepository(batch.Remote, dir, username, token, logger); err != nil {
+		return err
+	}
+	batch.Path = dir
+	return nil
+}
+
+// cloneRepository clones remoteURL into dir. The GitHub credentials are passed for this
+// one command only and are kept out of the log.
+func cloneRepository(remoteURL, dir, username, token string, logger *log.Logger) error {
+	logger.Printf("[%s] Executing: git clone %s %s", time.Now().Format("2006-01-02 15:04:05"), remoteURL, dir)
+	header := fmt.Sprintf("http.https://github.com/.extraheader=Authorization: Basic %s", encodeBasicAuth(username, token))
+	output, err := exec.Command("git", "-c", header, "clone", "--quiet", remoteURL, dir).CombinedOutput()
+	if err != nil {
+		logger.Printf("[%s] ERROR: Clone output: %s", time.Now().Format("2006-01-02 15:04:05"), strings.TrimSpace(string(output)))
+		return fmt.Errorf("failed to clone %s: %v: %s", remoteURL, err, strings.TrimSpace(string(output)))
+	}
+	logger.Printf("[%s] Cloned %s into %s", time.Now().Format("2006-01-02 15:04:05"), remoteURL, dir)
+	return nil
+}
+
+// cleanupWorkspaces releases the repository locks and deletes the --ephemeral
+// workspaces and the generated allowed signers file. Reports and logs live outside
+// them, so nothing of the run is lost.
+func cleanupWorkspaces() {
+	for _, path := range heldLocks {
+		os.Remove(path)
+	}
+	heldLocks = nil
+	if allowedSignersTemp != "" {
+		os.Remove(allowedSignersTemp)
+		allowedSignersTemp = ""
+	}
+	for _, dir := range ephemeralClones {
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("Warning: failed to remove temporary workspace %s: %v\n", dir, err)
+		}
+	}
+	ephemeralClones = nil
+}
+
+// lockFileName is shared by all executors, so none of them runs in a clone another one
+// is using.
+const lockFileName = "scenario-executor.lock"
+
+// ExecutorLock is the content of the advisory lock file an executor holds while it runs.
+type ExecutorLock struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Executor  string    `json:"executor"`
+	Scenario  string    `json:"scenario"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// heldLocks are the lock files this run created, released by cleanupWorkspaces.
+var heldLocks []string
+
+// acquireLock creates the lock file in the repository's git directory. A lock left by a
+// process on this host that is no longer running is stale and replaced; force replaces
+// any lock. A live lock is an error that says who holds it.
+func acquireLock(repoDir, scenarioFile string, force bool, logger *log.Logger) error {
+	output, err := gitCommand(repoDir, "rev-parse", "--absolute-git-dir").Output()
+	if err != nil {
+		return fmt.Errorf("cannot find the git directory: %v", err)
+	}
+	path := filepath.Join(strings.TrimSpace(string(output)), lockFileName)
+	
+	host, _ := os.Hostname()
+	data, _ := json.MarshalIndent(ExecutorLock{PID: os.Getpid(), Host: host, Executor: "create-update", Scenario: scenarioFile, StartedAt: time.Now()}, "", "  ")
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.Write(data)
+			file.Close()
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("failed to write lock file %s: %v", path, err)
+			}
+			heldLocks = append(heldLocks, path)
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to create lock file %s: %v", path, err)
+		}
+		
+		var holder ExecutorLock
+		content, _ := os.ReadFile(path)
+		if json.Unmarshal(content, &holder) != nil {
+			holder = ExecutorLock{}
+		}
+		switch {
+		case force:
+			logger.Printf("[%s] WARNING: --force-unlock removes the lock held by pid %d on %s since %s", time.Now().Format("2006-01-02 15:04:05"), holder.PID, holder.Host, holder.StartedAt.Format(time.RFC3339))
+		case holder.Host == host && holder.PID > 0 && !processAlive(holder.PID):
+			logger.Printf("[%s] Removing stale lock of pid %d, which is no longer running", time.Now().Format("2006-01-02 15:04:05"), holder.PID)
+		default:
+			return fmt.Errorf("repository is locked by %s (pid %d on %s, scenario %s) since %s; wait for it to finish or pass --force-unlock if it is gone", holder.Executor, holder.PID, holder.Host, holder.Scenario, holder.StartedAt.Format(time.RFC3339))
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove lock file %s: %v", path, err)
+		}
+	}
+	return fmt.Errorf("lock file %s was re-created by another executor", path)
+}
+
+// processAlive reports whether a process with this PID is running on this host.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true // FindProcess only succeeds for running processes
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// preflight checks that a repository is safe to run in: no uncommitted changes to tracked
+// files (git add and git commit would sweep them into scenario commits), the expected
+// branch with an upstream to pull from and push to, and an origin that answers with the
+// configured credentials. It returns every problem found.
+func preflight(repoDir, expectedBranch string, logger *log.Logger, retry RetryPolicy) []string {
+	var problems []string
+	
+	if output, err := gitCommand(repoDir, "status", "--porcelain", "--untracked-files=no").Output(); err != nil {
+		problems = append(problems, fmt.Sprintf("cannot read worktree status: %v", err))
+	} else if dirty := strings.TrimSpace(string(output)); dirty != "" {
+		changes := strings.Split(dirty, "\n")
+		problems = append(problems, fmt.Sprintf("worktree has uncommitted changes to %d path(s), e.g. %q; commit or stash them first", len(changes), strings.TrimSpace(changes[0])))
+	}
+	
+	output, err := gitCommand(repoDir, "symbolic-ref", "--short", "-q", "HEAD").Output()
+	branch := strings.TrimSpace(string(output))
+	switch {
+	case err != nil || branch == "":
+		problems = append(problems, "HEAD is detached; check out a branch first")
+	case expectedBranch != "" && branch != expectedBranch:
+		problems = append(problems, fmt.Sprintf("on branch %s, expected %s (--branch)", branch, expectedBranch))
+	default:
+		if _, err := gitCommand(repoDir, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}").Output(); err != nil {
+			problems = append(problems, fmt.Sprintf("branch %s has no upstream; set one with git branch --set-upstream-to=origin/%s", branch, branch))
+		}
+	}
+	
+	if err := executeGitCommandWithRetry(repoDir, "ls-remote origin HEAD", logger, "preflight", 0, retry); err != nil {
+		if isCredentialFailure(err.Error()) {
+			problems = append(problems, fmt.Sprintf("origin rejected the credentials, check --username and --token: %v", err))
+		} else {
+			problems = append(problems, fmt.Sprintf("origin is not reachable: %v", err))
+		}
+	}
+	return problems
+}
+
+func isCredentialFailure(output string) bool {
+	for _, pattern := range []string{"Authentication failed", "could not read Username", "could not read Password", "returned error: 401", "returned error: 403"} {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// notExecuted returns skipped results for operations a stopped run never reached.
+func notExecuted(operations []ScenarioOperation, repository string) []OperationResult {
+	var results []OperationResult
+	for _, op := range operations {
+		results = append(results, OperationResult{
+			LineNumber:    op.LineNumber,
+			FilePath:      op.FilePath,
+			OperationType: op.OperationType,
+			CommitMessage: op.CommitMessage,
+			Origin:        op.Origin,
+			Repository:    repository,
+			Status:        "skipped",
+			Error:         "not executed: run stopped by --on-error policy",
+		})
+	}
+	return results
+}
+
+// runBatch runs one repository's operations in scenario order. It stops early when the
+// run was stopped by another worker or the --on-error policy says so.
+func runBatch(batch *RepositoryBatch, logger *log.Logger, scenarioFile string, options *ExecutionOptions, onError string, progress *RunProgress) {
+	progress.mu.Lock()
+	stopped := progress.Stopped
+	progress.mu.Unlock()
+	if stopped {
+		batch.Results = notExecuted(batch.Operations, batch.Name)
+		return
+	}
+	
+	logger.Printf("[%s] === Repository %s (%s): %d operation(s) ===", time.Now().Format("2006-01-02 15:04:05"), batch.Name, batch.Path, len(batch.Operations))
+	
+	if options.Atomic {
+		var err error
+		batch.Run, err = beginAtomicRun(batch.Path, logger, scenarioFile, options.Retry)
+		if err != nil {
+			logger.Printf("[%s] ERROR: Failed to start atomic run in %s: %v", time.Now().Format("2006-01-02 15:04:05"), batch.Name, err)
+			fmt.Printf("Error starting atomic run in %s: %v\n", batch.Name, err)
+			for _, result := range notExecuted(batch.Operations, batch.Name) {
+				result.Status = "failed"
+				result.Error = fmt.Sprintf("atomic run could not start: %v", err)
+				batch.Results = append(batch.Results, result)
+			}
+			progress.mu.Lock()
+			progress.Failed += len(batch.Operations)
+			progress.Stopped = true
+			progress.mu.Unlock()
+			return
+		}
+	}
+	
+	for i, op := range batch.Operations {
+		progress.mu.Lock()
+		stop := progress.Stopped || options.OnError.shouldStop(progress.Failed)
+		if stop && !progress.Stopped {
+			progress.Stopped = true
+			logger.Printf("[%s] Stopping after %d failed line(s) (--on-error %s)", time.Now().Format("2006-01-02 15:04:05"), progress.Failed, onError)
+		}
+		progress.mu.Unlock()
+		if stop {
+			batch.Results = append(batch.Results, notExecuted(batch.Operations[i:], batch.Name)...)
+			return
+		}
+		
+		if op.Origin != "" {
+			logger.Printf("[%s] --- Executing line %d (%s) ---", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber, op.Origin)
+		} else {
+			logger.Printf("[%s] --- Executing line %d ---", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber)
+		}
+		
+		result := OperationResult{
+			LineNumber:    op.LineNumber,
+			FilePath:      op.FilePath,
+			OperationType: op.OperationType,
+			CommitMessage: op.CommitMessage,
+			Origin:        op.Origin,
+			Repository:    batch.Name,
+		}
+		
+		waitForTurn(op, logger, options)
+		if batch.Run != nil {
+			batch.Run.noteCreatedPath(batch.Path, op)
+		}
+		result.StartedAt = time.Now()
+		err := executeOperation(batch.Path, op, logger, scenarioFile, options, &result)
+		result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+		progress.mu.Lock()
+		if err == nil {
+			progress.Succeeded++
+			result.Status = "success"
+			logger.Printf("[%s] Line %d completed successfully", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber)
+		} else {
+			progress.Failed++
+			result.Status = "failed"
+			result.Error = err.Error()
+			logger.Printf("[%s] Line %d failed", time.Now().Format("2006-01-02 15:04:05"), op.LineNumber)
+		}
+		progress.mu.Unlock()
+		batch.Results = append(batch.Results, result)
+	}
+}
+
+// waitForTurn holds an operation back until the pacing options allow it to start: its
+// replay time first, if it has one, then the operations-per-second limit.
+func waitForTurn(op ScenarioOperation, logger *log.Logger, options *ExecutionOptions) {
+	if options.ReplaySpeed > 0 && !op.Time.IsZero() {
+		offset := time.Duration(float64(op.Time.Sub(options.replayBase)) / options.ReplaySpeed)
+		if wait := time.Until(options.replayStart.Add(offset)); wait > 0 {
+			if wait >= time.Second {
+				logger.Printf("[%s] Waiting %s to replay line %d (%s)", time.Now().Format("2006-01-02 15:04:05"), wait.Round(time.Second), op.LineNumber, op.Time.Format(time.RFC3339))
+			}
+			time.Sleep(wait)
+		}
+	}
+	options.OpPacing.Wait()
+}
+
+func summarizeRepositories(batches []*RepositoryBatch, results []OperationResult) []RepositorySummary {
+	var summaries []RepositorySummary
+	for _, batch := range batches {
+		summary := RepositorySummary{Name: batch.Name, Path: batch.Path}
+		for _, r := range results {
+			if r.Repository != batch.Name {
+				continue
+			}
+			summary.Total++
+			switch r.Status {
+			case "success":
+				summary.Succeeded++
+			case "failed":
+				summary.Failed++
+			default:
+				summary.Skipped++
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries
+}
+
+func executeOperation(repoDir string, op ScenarioOperation, logger *log.Logger, scenarioFile string, options *ExecutionOptions, result *OperationResult) error {
+	logger.Printf("[%s] Operation: %s on %s", time.Now().Format("2006-01-02 15:04:05"), op.OperationType, op.FilePath)
+	
+	// Step 1: Pull (an atomic run pulls once before branching)
+	if !options.Atomic {
+		if err := executeGitCommandWithRetry(repoDir, "pull", logger, scenarioFile, op.LineNumber, options.Retry); err != nil {
+			return err
+		}
+	}
+	
+	// Step 2: Execute the operation
+	var err error
+	switch op.OperationType {
+	case "create":
+		err = executeCreateOperation(repoDir, op, logger, scenarioFile)
+	case "update":
+		err = executeUpdateOperation(repoDir, op, logger, scenarioFile)
+	case "delete":
+		err = runGit(repoDir, []string{"rm", "-r", "-q", "--", op.FilePath}, logger, scenarioFile, op.LineNumber)
+	case "move":
+		err = executeMoveOperation(repoDir, op, logger, scenarioFile)
+	default:
+		logger.Printf("[%s] ERROR: Unknown operation type: %s (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), op.OperationType, scenarioFile, op.LineNumber)
+		return fmt.Errorf("unknown operation type: %s", op.OperationType)
+	}
+	
+	if err != nil {
+		return err
+	}
+	
+	// Step 3: Add and commit (delete and move are staged by git rm / git mv)
+	if op.OperationType == "create" || op.OperationType == "update" {
+		if err := runGit(repoDir, []string{"add", "--", op.FilePath}, logger, scenarioFile, op.LineNumber); err != nil {
+			return err
+		}
+	}
+	
+	// Check if there are any changes to commit
+	if !hasChangesToCommit(repoDir, logger, scenarioFile, op.LineNumber) {
+		logger.Printf("[%s] No changes to commit for %s, skipping commit", time.Now().Format("2006-01-02 15:04:05"), op.FilePath)
+		return nil
+	}
+	
+	commitArgs := []string{"commit", "-m", op.CommitMessage}
+	if op.Author != "" {
+		commitArgs = append(commitArgs, "--author="+op.Author)
+	}
+	if options.Provenance == "trailers" {
+		for _, trailer := range provenanceLines(scenarioFile, op.LineNumber, op.Origin, options.RunID) {
+			commitArgs = append(commitArgs, "--trailer", trailer)
+		}
+	}
+	if err := runGit(repoDir, commitArgs, logger, scenarioFile, op.LineNumber); err != nil {
+		return err
+	}
+	result.CommitSHA = currentCommitSHA(repoDir)
+	result.FilesTouched = []string{op.FilePath}
+	if op.TargetPath != "" {
+		result.FilesTouched = append(result.FilesTouched, op.TargetPath)
+	}
+	
+	// Step 4: Push (an atomic run pushes once at the end)
+	if options.Atomic {
+		return nil
+	}
+	if err := pushWithRetry(repoDir, op, logger, scenarioFile, options); err != nil {
+		return err
+	}
+	// A rebase rewrites the scenario commit; a merge keeps it as the merge's first
+	// parent, so the SHA recorded before the push still names it
+	if options.SyncStrategy != "merge" {
+		result.CommitSHA = currentCommitSHA(repoDir)
+	}
+
+	return nil
+}
+
+// AtomicRun tracks the temporary branch an --atomic run commits to, and where to
+// return to if the run has to be rolled back.
+type AtomicRun struct {
+	OriginalBranch string
+	BaseCommit     string
+	TempBranch     string
+	Created        []string // paths the run wrote that did not exist at BaseCommit
+}
+
+// noteCreatedPath records a path the operation is about to write if neither the working
+// copy nor BaseCommit has it, so that a rollback can remove it if it was never committed.
+// When its folders are missing too, the topmost missing one is recorded instead. Anything
+// else under the scenario's paths may be the developer's untracked work.
+func (run *AtomicRun) noteCreatedPath(repoDir string, op ScenarioOperation) {
+	path := op.FilePath
+	if op.OperationType == "move" {
+		path = op.TargetPath
+	} else if op.OperationType != "create" {
+		return
+	}
+	if _, err := os.Lstat(filepath.Join(repoDir, path)); !os.IsNotExist(err) {
+		return
+	}
+	for parent := filepath.Dir(path); parent != "."; parent = filepath.Dir(parent) {
+		if _, err := os.Lstat(filepath.Join(repoDir, parent)); !os.IsNotExist(err) {
+			break
+		}
+		path = parent
+	}
+	if gitCommand(repoDir, "cat-file", "-e", run.BaseCommit+":"+filepath.ToSlash(path)).Run() == nil {
+		return
+	}
+	run.Created = append(run.Created, path)
+}
+
+// beginAtomicRun pulls once, remembers the pre-run commit and switches to a fresh branch.
+func beginAtomicRun(repoDir string, logger *log.Logger, scenarioFile string, retry RetryPolicy) (*AtomicRun, error) {
+	if err := executeGitCommandWithRetry(repoDir, "pull", logger, scenarioFile, 0, retry); err != nil {
+		return nil, err
+	}
+	
+	branch, err := gitCommand(repoDir, "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read current branch: %v", err)
+	}
+	run := &AtomicRun{
+		OriginalBranch: strings.TrimSpace(string(branch)),
+		BaseCommit:     currentCommitSHA(repoDir),
+		TempBranch:     fmt.Sprintf("scenario-run-%s", time.Now().Format("20060102-150405")),
+	}
+	if run.OriginalBranch == "HEAD" || run.BaseCommit == "" {
+		return nil, fmt.Errorf("repository is not on a branch")
+	}
+	
+	if err := executeGitCommand(repoDir, "checkout -b "+run.TempBranch, logger, scenarioFile, 0); err != nil {
+		return nil, err
+	}
+	logger.Printf("[%s] Atomic run on branch %s (base %s, target %s)", 
+		time.Now().Format("2006-01-02 15:04:05"), run.TempBranch, run.BaseCommit, run.OriginalBranch)
+	return run, nil
+}
+
+// finish fast-forwards the original branch to the temporary one and pushes it.
+func (run *AtomicRun) finish(repoDir string, logger *log.Logger, scenarioFile string, options *ExecutionOptions) error {
+	if err := executeGitCommand(repoDir, "checkout "+run.OriginalBranch, logger, scenarioFile, 0); err != nil {
+		return err
+	}
+	if err := executeGitCommand(repoDir, "merge --ff-only "+run.TempBranch, logger, scenarioFile, 0); err != nil {
+		return err
+	}
+	
+	op := ScenarioOperation{FilePath: run.TempBranch}
+	if err := pushWithRetry(repoDir, op, logger, scenarioFile, options); err != nil {
+		return err
+	}
+	
+	if err := executeGitCommand(repoDir, "branch -D "+run.TempBranch, logger, scenarioFile, 0); err != nil {
+		logger.Printf("[%s] WARNING: Failed to delete temporary branch %s: %v", time.Now().Format("2006-01-02 15:04:05"), run.TempBranch, err)
+	}
+	return nil
+}
+
+// rollback returns the original branch to the pre-run commit, drops the temporary
+// branch and removes files the scenario left behind. It returns the discarded commits.
+func (run *AtomicRun) rollback(repoDir string, logger *log.Logger, scenarioFile string) ([]string, error) {
+	var rolledBack []string
+	output, err := gitCommand(repoDir, "log", "--format=%h %s", run.BaseCommit+".."+run.TempBranch).Output()
+	if err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if line != "" {
+				rolledBack = append(rolledBack, line)
+			}
+		}
+	}
+	
+	if err := executeGitCommand(repoDir, "checkout -f "+run.OriginalBranch, logger, scenarioFile, 0); err != nil {
+		return rolledBack, err
+	}
+	if err := executeGitCommand(repoDir, "reset --hard "+run.BaseCommit, logger, scenarioFile, 0); err != nil {
+		return rolledBack, err
+	}
+	if err := executeGitCommand(repoDir, "branch -D "+run.TempBranch, logger, scenarioFile, 0); err != nil {
+		return rolledBack, err
+	}
+	
+	// The reset removed everything the run committed or staged; what is left of the
+	// paths it created was written but never added
+	for _, path := range run.Created {
+		if err := os.RemoveAll(filepath.Join(repoDir, path)); err != nil {
+			logger.Printf("[%s] WARNING: Failed to remove %s: %v", time.Now().Format("2006-01-02 15:04:05"), path, err)
+		}
+	}
+	
+	for _, commit := range rolledBack {
+		logger.Printf("[%s] Rolled back: %s", time.Now().Format("2006-01-02 15:04:05"), commit)
+	}
+	return rolledBack, nil
+}
+
+// pushWithRetry pushes and, if the remote moved on since our pull, integrates the
+// remote changes with the configured strategy and tries again with backoff.
+func pushWithRetry(repoDir string, op ScenarioOperation, logger *log.Logger, scenarioFile string, options *ExecutionOptions) error {
+	options.pushLock.Lock()
+	defer options.pushLock.Unlock()
+	
+	backoff := options.PushBackoff
+	for attempt := 0; ; attempt++ {
+		options.PushPacing.Wait()
+		err := executeGitCommandWithRetry(repoDir, "push", logger, scenarioFile, op.LineNumber, options.Retry)
+		if err == nil {
+			return nil
+		}
+		if !isPushRejected(err) {
+			return err
+		}
+		if attempt >= options.PushRetries {
+			return fmt.Errorf("push still rejected after %d retries: %v", options.PushRetries, err)
+		}
+		
+		logger.Printf("[%s] Push rejected (non-fast-forward), retry %d/%d in %s using %s", 
+			time.Now().Format("2006-01-02 15:04:05"), attempt+1, options.PushRetries, backoff, options.SyncStrategy)
+		time.Sleep(backoff)
+		backoff *= 2
+		
+		if err := syncWithRemote(repoDir, op, logger, scenarioFile, options.SyncStrategy, options.Retry); err != nil {
+			return err
+		}
+	}
+}
+
+func isPushRejected(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "non-fast-forward") || 
+		strings.Contains(msg, "fetch first") || 
+		strings.Contains(msg, "Updates were rejected")
+}
+
+// syncWithRemote rebases (or merges) our local commits onto the remote branch. On a
+// conflict the half-finished rebase/merge is aborted so the repository is left usable.
+func syncWithRemote(repoDir string, op ScenarioOperation, logger *log.Logger, scenarioFile string, strategy string, retry RetryPolicy) error {
+	pullCmd, abortCmd := "pull --rebase", "rebase --abort"
+	if strategy == "merge" {
+		pullCmd, abortCmd = "pull --no-rebase --no-edit", "merge --abort"
+	}
+	
+	err := executeGitCommandWithRetry(repoDir, pullCmd, logger, scenarioFile, op.LineNumber, retry)
+	if err == nil {
+		return nil
+	}
+	if isTransientGitFailure(err.Error()) {
+		return fmt.Errorf("failed to fetch remote changes: %v", err)
+	}
+	
+	if abortErr := executeGitCommand(repoDir, abortCmd, logger, scenarioFile, op.LineNumber); abortErr != nil {
+		logger.Printf("[%s] WARNING: Failed to abort %s: %v", time.Now().Format("2006-01-02 15:04:05"), strategy, abortErr)
+	}
+	return fmt.Errorf("conflict while trying to %s %s onto remote changes (scenario: %s, line: %d): %v", 
+		strategy, op.FilePath, scenarioFile, op.LineNumber, err)
+}
+
+// configureGitCredentials sets up HTTP Basic Auth in the current repository. A non-empty
+// remoteURL becomes the origin; an empty one keeps the clone's own origin.
+func configureGitCredentials(repoDir, username, token, remoteURL string, logger *log.Logger) error {
+	logger.Printf("[%s] Configuring git credentials with HTTP Basic Auth...", time.Now().Format("2006-01-02 15:04:05"))
+	
+	// Set git config for the current repository (local config)
+	cmd := gitCommand(repoDir, "config", "--local", "user.name", username)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		logger.Printf("[%s] ERROR: Git config user.name output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
+		return fmt.Errorf("failed to set git user.name: %v", err)
+	}
+	
+	// Set default email
+	email := username + "@users.noreply.github.com"
+	cmd = gitCommand(repoDir, "config", "--local", "user.email", email)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		logger.Printf("[%s] ERROR: Git config user.email output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
+		return fmt.Errorf("failed to set git user.email: %v", err)
+	}
+	
+	logger.Printf("[%s] Set git user.name: %s", time.Now().Format("2006-01-02 15:04:05"), username)
+	logger.Printf("[%s] Set git user.email: %s", time.Now().Format("2006-01-02 15:04:05"), email)
+	
+	// Configure HTTP Basic Auth for GitHub
+	// Set credential helper to store credentials
+	cmd = gitCommand(repoDir, "config", "--local", "credential.helper", "store")
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		logger.Printf("[%s] ERROR: Git config credential.helper output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
+		return fmt.Errorf("failed to set credential helper: %v", err)
+	}
+	
+	// Configure HTTP Basic Auth specifically for github.com
+	cmd = gitCommand(repoDir, "config", "--local", "http.https://github.com/.extraheader", fmt.Sprintf("Authorization: Basic %s", encodeBasicAuth(username, token)))
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		logger.Printf("[%s] ERROR: Git config http auth output: %s", time.Now().Format("2006-01-02 15:04:05"), string(output))
+		return fmt.Errorf("failed to set HTTP basic auth: %v", err)
+	}
+	
+	// Alternative approach: Set credential.username and use askpass helper
+	cmd = gitCommand(repoDir, "config", "--local", "credential.https://github.com.username", username)
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		logger.Printf("[%s] WARNING: Failed to set credential username: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+	}
+	
+	// Ensure we're using HTTPS URL (not SSH)
+	if remoteURL != "" {
+		err = ensureHTTPSRemote(repoDir, logger, remoteURL)
+		if err != nil {
+			logger.Printf("[%s] WARNING: Failed to ensure HTTPS remote: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+		}
+	} else if output, err := gitCommand(repoDir, "remote", "get-url", "origin").Output(); err == nil {
+		remoteURL = strings.TrimSpace(string(output))
+	}
+	
+	// Create credential file for git credential store
+	if strings.HasPrefix(remoteURL, "https://") || strings.HasPrefix(remoteURL, "http://") {
+		err = createCredentialFile(username, token, remoteURL, logger)
+		if err != nil {
+			logger.Printf("[%s] WARNING: Failed to create credential file: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+		}
+	}
+	
+	logger.Printf("[%s] Git HTTP Basic Auth configured successfully", time.Now().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+func encodeBasicAuth(username, token string) string {
+	auth := username + ":" + token
+	return base64.StdEncoding.EncodeToString([]byte(auth))
+}
+
+func ensureHTTPSRemote(repoDir string, logger *log.Logger, targetURL string) error {
+	// Get current remote URL
+	cmd := gitCommand(repoDir, "remote", "get-url", "origin")
+	output, err := cmd.Output()
+	if err != nil {
+		logger.Printf("[%s] No remote origin found, adding it...", time.Now().Format("2006-01-02 15:04:05"))
+		// Add the remote if it doesn't exist
+		cmd = gitCommand(repoDir, "remote", "add", "origin", targetURL)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to add remote origin: %v, output: %s", err, string(output))
+		}
+		logger.Printf("[%s] Added remote origin: %s", time.Now().Format("2006-01-02 15:04:05"), targetURL)
+		return nil
+	}
+	
+	remoteURL := strings.TrimSpace(string(output))
+	logger.Printf("[%s] Current remote URL: %s", time.Now().Format("2006-01-02 15:04:05"), remoteURL)
+	
+	// Always set to our target URL to ensure consistency
+	if remoteURL != targetURL {
+		cmd = gitCommand(repoDir, "remote", "set-url", "origin", targetURL)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to set remote URL: %v, output: %s", err, string(output))
+		}
+		logger.Printf("[%s] Updated remote URL to: %s", time.Now().Format("2006-01-02 15:04:05"), targetURL)
+	} else {
+		logger.Printf("[%s] Remote URL is already correct", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	
+	return nil
+}
+
+func createCredentialFile(username, token, remoteURL string, logger *log.Logger) error {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %v", err)
+	}
+	
+	credentialFile := filepath.Join(homeDir, ".git-credentials")
+	// Use the specific repository URL
+	scheme, hostAndPath, _ := strings.Cut(remoteURL, "://")
+	credentialEntry := fmt.Sprintf("%s://%s:%s@%s\n", scheme, username, token, hostAndPath)
+	
+	// Check if file exists and if our entry is already there
+	if _, err := os.Stat(credentialFile); err == nil {
+		content, err := os.ReadFile(credentialFile)
+		if err == nil && strings.Contains(string(content), strings.TrimSuffix(hostAndPath, ".git")) {
+			logger.Printf("[%s] Credential file already contains entry for %s", time.Now().Format("2006-01-02 15:04:05"), remoteURL)
+			return nil
+		}
+	}
+	
+	// Append our credentials to the file
+	file, err := os.OpenFile(credentialFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open credential file: %v", err)
+	}
+	defer file.Close()
+	
+	_, err = file.WriteString(credentialEntry)
+	if err != nil {
+		return fmt.Errorf("failed to write to credential file: %v", err)
+	}
+	
+	logger.Printf("[%s] Created/updated git credential file for repository: %s", time.Now().Format("2006-01-02 15:04:05"), remoteURL)
+	return nil
+}
+
+func executeCreateOperation(repoDir string, op ScenarioOperation, logger *log.Logger, scenarioFile string) error {
+	// Create directory if it doesn't exist
+	dir := filepath.Dir(op.FilePath)
+	err := os.MkdirAll(filepath.Join(repoDir, dir), 0755)
+	if err != nil {
+		logger.Printf("[%s] ERROR: Failed to create directory %s: %v (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), dir, err, scenarioFile, op.LineNumber)
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	
+	// Create the file, empty unless the scenario gives content
+	err = os.WriteFile(filepath.Join(repoDir, op.FilePath), []byte(op.FileContent), 0644)
+	if err != nil {
+		logger.Printf("[%s] ERROR: Failed to create file %s: %v (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, err, scenarioFile, op.LineNumber)
+		return fmt.Errorf("failed to create file %s: %v", op.FilePath, err)
+	}
+	
+	logger.Printf("[%s] Created file: %s", time.Now().Format("2006-01-02 15:04:05"), op.FilePath)
+	return nil
+}
+
+func executeMoveOperation(repoDir string, op ScenarioOperation, logger *log.Logger, scenarioFile string) error {
+	dir := filepath.Dir(op.TargetPath)
+	err := os.MkdirAll(filepath.Join(repoDir, dir), 0755)
+	if err != nil {
+		logger.Printf("[%s] ERROR: Failed to create directory %s: %v (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), dir, err, scenarioFile, op.LineNumber)
+		return fmt.Errorf("failed to create directory %s: %v", dir, err)
+	}
+	
+	if err := runGit(repoDir, []string{"mv", "--", op.FilePath, op.TargetPath}, logger, scenarioFile, op.LineNumber); err != nil {
+		return err
+	}
+	
+	logger.Printf("[%s] Moved %s to %s", time.Now().Format("2006-01-02 15:04:05"), op.FilePath, op.TargetPath)
+	return nil
+}
+
+func executeUpdateOperation(repoDir string, op ScenarioOperation, logger *log.Logger, scenarioFile string) error {
+	// Check if file exists
+	if _, err := os.Stat(filepath.Join(repoDir, op.FilePath)); os.IsNotExist(err) {
+		logger.Printf("[%s] ERROR: File does not exist for update: %s (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, scenarioFile, op.LineNumber)
+		return fmt.Errorf("file does not exist for update: %s", op.FilePath)
+	}
+	
+	// Read current content to check if update is needed
+	currentContent, err := os.ReadFile(filepath.Join(repoDir, op.FilePath))
+	if err != nil {
+		logger.Printf("[%s] ERROR: Failed to read current file content %s: %v (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, err, scenarioFile, op.LineNumber)
+		return fmt.Errorf("failed to read current file content %s: %v", op.FilePath, err)
+	}
+	
+	// Check if content is already the same
+	if string(currentContent) == op.FileContent {
+		logger.Printf("[%s] File %s already has the same content, no update needed", 
+			time.Now().Format("2006-01-02 15:04:05"), op.FilePath)
+		return nil
+	}
+	
+	// Write content to file
+	err = os.WriteFile(filepath.Join(repoDir, op.FilePath), []byte(op.FileContent), 0644)
+	if err != nil {
+		logger.Printf("[%s] ERROR: Failed to update file %s: %v (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), op.FilePath, err, scenarioFile, op.LineNumber)
+		return fmt.Errorf("failed to update file %s: %v", op.FilePath, err)
+	}
+	
+	logger.Printf("[%s] Updated file: %s with content: %s", time.Now().Format("2006-01-02 15:04:05"), op.FilePath, op.FileContent)
+	return nil
+}
+
+func hasChangesToCommit(repoDir string, logger *log.Logger, scenarioFile string, lineNumber int) bool {
+	cmd := gitCommand(repoDir, "diff", "--cached", "--quiet")
+	err := cmd.Run()
+	
+	// git diff --cached --quiet returns:
+	// - exit code 0 if no changes (no differences)
+	// - exit code 1 if there are changes
+	// - other exit codes for errors
+	
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
+			// Exit code 1 means there are staged changes
+			return true
+		}
+		// Other exit codes indicate an error
+		logger.Printf("[%s] WARNING: Error checking for staged changes: %v (scenario: %s, line: %d)", 
+			time.Now().Format("2006-01-02 15:04:05"), err, scenarioFile, lineNumber)
+		return true // Assume there are changes to be safe
+	}
+	
+	// Exit code 0 means no staged changes
+	return false
+}
+
+func executeGitCommand(repoDir, gitCmd string, logger *log.Logger, scenarioFile string, lineNumber int) error {
+	// Parse the command more carefully to handle quotes properly
+	return runGit(repoDir, parseGitCommand(gitCmd), logger, scenarioFile, lineNumber)
+}
+
+// runGit runs git with args as they are. Commands that carry scenario data (paths,
+// messages, authors) use it directly, because no quoting survives parseGitCommand for
+// every file name or message.
+func runGit(repoDir string, args []string, logger *log.Logger, scenarioFile string, lineNumber int) error {
+	cmd := gitCommand(repoDir, args...)
+	gitCmd := formatGitArgs(args)
+	
+	logger.Printf("[%s] Executing: git %s", time.Now().Format("2006-01-02 15:04:05"), gitCmd)
+	
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		// Special handling for common git errors
+		outputStr := string(output)
+		if strings.Contains(outputStr, "nothing to commit") || strings.Contains(outputStr, "no changes added to commit") {
+			logger.Printf("[%s] INFO: No changes to commit - this is expected in some cases", time.Now().Format("2006-01-02 15:04:05"))
+			return nil
+		}
+		
+		logger.Printf("[%s] ERROR: Git command failed: git %s", time.Now().Format("2006-01-02 15:04:05"), gitCmd)
+		logger.Printf("[%s] ERROR: %v", time.Now().Format("2006-01-02 15:04:05"), err)
+		logger.Printf("[%s] ERROR: Output: %s", time.Now().Format("2006-01-02 15:04:05"), outputStr)
+		logger.Printf("[%s] ERROR: Scenario file: %s, Line: %d", time.Now().Format("2006-01-02 15:04:05"), scenarioFile, lineNumber)
+		return fmt.Errorf("git %s failed: %v: %s", gitCmd, err, strings.TrimSpace(outputStr))
+	}
+	
+	if len(output) > 0 {
+		logger.Printf("[%s] Git output: %s", time.Now().Format("2006-01-02 15:04:05"), strings.TrimSpace(string(output)))
+	}
+	
+	return nil
+}
+
+// formatGitArgs renders args for the log, quoting those that would not read back as
+// one argument.
+func formatGitArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// gitCommand prepares a git command that runs in repoDir. Parallel workers share the
+// process working directory, so every git call names its repository explicitly.
+func gitCommand(repoDir string, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", append(signing.configArgs(), args...)...)
+	cmd.Dir = repoDir
+	return cmd
+}
+
+// notesRef holds the provenance notes of every executor.
+const notesRef = "refs/notes/scenario"
+
+// newRunID names a run after its start time, with a random suffix for runs started in
+// the same second.
+func newRunID() string {
+	return fmt.Sprintf("%s-%04x", time.Now().UTC().Format("20060102T150405Z"), rand.Intn(0x10000))
+}
+
+// provenanceLines are the trailers, or note lines, that link a commit to the scenario
+// line that produced it.
+func provenanceLines(scenarioFile string, line int, origin, runID string) []string {
+	lines := []string{
+		"Scenario-File: " + filepath.ToSlash(scenarioFile),
+		fmt.Sprintf("Scenario-Line: %d", line),
+	}
+	if origin != "" {
+		lines = append(lines, "Scenario-Origin: "+origin)
+	}
+	return append(lines, "Run-ID: "+runID)
+}
+
+// writeProvenanceNotes attaches a note to every commit in results and pushes the notes
+// ref. The notes are added on top of the remote's notes, so notes of earlier runs are
+// kept; if another run pushed notes meanwhile, this is done again on top of those.
+func writeProvenanceNotes(repoDir string, results []OperationResult, logger *log.Logger, scenarioFile string, options *ExecutionOptions) error {
+	for attempt := 0; ; attempt++ {
+		remote, err := gitCommand(repoDir, "ls-remote", "origin", notesRef).Output()
+		if err != nil {
+			return fmt.Errorf("failed to look up %s on origin: %v", notesRef, err)
+		}
+		if strings.TrimSpace(string(remote)) != "" {
+			if err := executeGitCommandWithRetry(repoDir, fmt.Sprintf("fetch origin +%s:%s", notesRef, notesRef), logger, scenarioFile, 0, options.Retry); err != nil {
+				return err
+			}
+		}
+		
+		notes := 0
+		for _, r := range results {
+			if r.CommitSHA == "" {
+				continue
+			}
+			note := strings.Join(provenanceLines(scenarioFile, r.LineNumber, r.Origin, options.RunID), "\n")
+			if output, err := gitCommand(repoDir, "notes", "--ref="+notesRef, "add", "-f", "-m", note, r.CommitSHA).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to add note to %s: %v: %s", r.CommitSHA, err, strings.TrimSpace(string(output)))
+			}
+			notes++
+		}
+		if notes == 0 {
+			return nil
+		}
+		
+		err = executeGitCommandWithRetry(repoDir, fmt.Sprintf("push origin %s", notesRef), logger, scenarioFile, 0, options.Retry)
+		if err == nil {
+			logger.Printf("[%s] Pushed %d provenance note(s) to %s", time.Now().Format("2006-01-02 15:04:05"), notes, notesRef)
+			return nil
+		}
+		if attempt >= options.PushRetries || !(strings.Contains(err.Error(), "fetch first") || strings.Contains(err.Error(), "non-fast-forward")) {
+			return err
+		}
+		logger.Printf("[%s] Notes push rejected, adding the notes again on top of the remote's", time.Now().Format("2006-01-02 15:04:05"))
+	}
+}
+
+// configArgs are the -c options that make git sign commits as configured.
+func (s SigningConfig) configArgs() []string {
+	if s.Format == "" {
+		return nil
+	}
+	format := "openpgp"
+	if s.Format == "ssh" {
+		format = "ssh"
+	}
+	args := []string{"-c", "commit.gpgsign=true", "-c", "gpg.format=" + format}
+	if s.Key != "" {
+		args = append(args, "-c", "user.signingkey="+s.Key)
+	}
+	if s.AllowedSigners != "" {
+		args = append(args, "-c", "gpg.ssh.allowedSignersFile="+s.AllowedSigners)
+	}
+	return args
+}
+
+// writeAllowedSigners trusts the --signing-key public key for any committer, so the
+// executor can verify the SSH signatures it made without an allowed signers file.
+func writeAllowedSigners() error {
+	publicKey, err := sshPublicKey(signing.Key)
+	if err != nil {
+		return err
+	}
+	file, err := os.CreateTemp("", "scenario-allowed-signers-")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	allowedSignersTemp = file.Name()
+	if _, err := fmt.Fprintf(file, "* %s\n", publicKey); err != nil {
+		return err
+	}
+	signing.AllowedSigners = file.Name()
+	return nil
+}
+
+// sshPublicKey returns the public key for an SSH signing key given the way git accepts
+// it: a "key::" literal, a public key file, or a private key file with or without a
+// .pub file next to it.
+func sshPublicKey(key string) (string, error) {
+	if strings.HasPrefix(key, "key::") {
+		return strings.TrimPrefix(key, "key::"), nil
+	}
+	for _, path := range []string{key, key + ".pub"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		line := strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+		if strings.HasPrefix(line, "ssh-") || strings.HasPrefix(line, "ecdsa-") || strings.HasPrefix(line, "sk-") {
+			return line, nil
+		}
+	}
+	output, err := exec.Command("ssh-keygen", "-y", "-f", key).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the public key of %s: %v", key, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// verifyCommitSignature reports how git judges the signature of a commit, and who made it.
+func verifyCommitSignature(repoDir, sha string) (string, string) {
+	output, err := gitCommand(repoDir, "log", "-1", "--format=%G?%x00%GS%x00%GK", sha).Output()
+	if err != nil {
+		return "unverifiable", ""
+	}
+	fields := strings.SplitN(strings.TrimSpace(string(output)), "\x00", 3)
+	signer := ""
+	if len(fields) == 3 {
+		// The generated allowed signers file names no principal; the key identifies the signer
+		signer = fields[1]
+		if signer == "" || signer == "*" {
+			signer = fields[2]
+		}
+	}
+	switch fields[0] {
+	case "G":
+		return "good", signer
+	case "U":
+		return "untrusted", signer
+	case "B":
+		return "bad", signer
+	case "X", "Y":
+		return "expired", signer
+	case "R":
+		return "revoked", signer
+	case "N":
+		return "unsigned", ""
+	}
+	return "unverifiable", signer
+}
+
+func currentCommitSHA(repoDir string) string {
+	output, err := gitCommand(repoDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// executeGitCommandWithRetry runs a network-facing git command and retries it while
+// the failure looks transient. Permanent failures are returned straight away.
+func executeGitCommandWithRetry(repoDir, gitCmd string, logger *log.Logger, scenarioFile string, lineNumber int, policy RetryPolicy) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = executeGitCommand(repoDir, gitCmd, logger, scenarioFile, lineNumber)
+		if err == nil || !isTransientGitFailure(err.Error()) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %v", attempt, err)
+		}
+		
+		delay := retryDelay(policy, attempt)
+		logger.Printf("[%s] Transient failure on git %s, attempt %d/%d, retrying in %s", 
+			time.Now().Format("2006-01-02 15:04:05"), gitCmd, attempt, policy.MaxAttempts, delay)
+		time.Sleep(delay)
+	}
+}
+
+// Failures we never retry: the same request will fail the same way again.
+var permanentGitFailures = []string{
+	"Authentication failed",
+	"could not read Username",
+	"could not read Password",
+	"Permission denied",
+	"returned error: 401",
+	"returned error: 403",
+	"returned error: 404",
+	"Repository not found",
+	"CONFLICT",
+	"non-fast-forward",
+	"Updates were rejected",
+	"fetch first",
+}
+
+// Failures caused by the network, the server or another git process holding a lock.
+var transientGitFailures = []string{
+	"Could not resolve host",
+	"Connection timed out",
+	"Connection reset",
+	"Connection refused",
+	"Operation timed out",
+	"timed out",
+	"early EOF",
+	"Empty reply from server",
+	"unexpected disconnect",
+	"The remote end hung up unexpectedly",
+	"RPC failed",
+	"returned error: 500",
+	"returned error: 502",
+	"returned error: 503",
+	"returned error: 504",
+	"Internal Server Error",
+	"Bad Gateway",
+	"Service Unavailable",
+	"index.lock",
+	"Unable to create",
+	"cannot lock ref",
+	"TLS handshake timeout",
+}
+
+func isTransientGitFailure(output string) bool {
+	for _, pattern := range permanentGitFailures {
+		if strings.Contains(output, pattern) {
+			return false
+		}
+	}
+	for _, pattern := range transientGitFailures {
+		if strings.Contains(output, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay is exponential backoff capped at MaxBackoff, with +/- Jitter applied.
+func retryDelay(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.InitialBackoff << uint(attempt-1)
+	if delay <= 0 || (policy.MaxBackoff > 0 && delay > policy.MaxBackoff) {
+		delay = policy.MaxBackoff
+	}
+	if policy.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * policy.Jitter * float64(delay))
+	}
+	return delay
+}
+
+func parseGitCommand(gitCmd string) []string {
+	// Handle commands with quoted arguments properly
+	var parts []string
+	var current strings.Builder
+	inQuotes := false
+	escaped := false
+	
+	for _, char := range gitCmd {
+		if escaped {
+			current.WriteRune(char)
+			escaped = false
+			continue
+		}
+		
+		if char == '\\' {
+			escaped = true
+			continue
+		}
+		
+		if char == '"' || char == '\'' {
+			if !inQuotes {
+				inQuotes = true
+			} else {
+				inQuotes = false
+			}
+			continue
+		}
+		
+		if char == ' ' && !inQuotes {
+			if current.Len() > 0 {
+				parts = append(parts, current.String())
+				current.Reset()
+			}
+		} else {
+			current.WriteRune(char)
+		}
+	}
+	
+	// Add the last part
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	
+	return parts
+}
+
+func resolveOutputPath(path, baseDir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+func writeJSONReport(path string, report ExecutionReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitReport emits one test case per scenario line so CI can show runs as test results.
+func writeJUnitReport(path string, report ExecutionReport) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("%s: %s", report.Executor, report.Scenario),
+		Tests:     report.Total,
+		Failures:  report.Failed,
+		Skipped:   report.Skipped,
+		Time:      fmt.Sprintf("%.3f", report.FinishedAt.Sub(report.StartedAt).Seconds()),
+		Timestamp: report.StartedAt.Format(time.RFC3339),
+	}
+	
+	for _, r := range report.Results {
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("line %d: %s %s", r.LineNumber, r.OperationType, r.FilePath),
+			ClassName: report.Scenario,
+			Time:      fmt.Sprintf("%.3f", float64(r.DurationMs)/1000),
+		}
+		if len(report.Repositories) > 0 {
+			// Group test cases by repository in multi-repository runs
+			tc.ClassName = fmt.Sprintf("%s.%s", report.Scenario, r.Repository)
+		}
+		if r.CommitSHA != "" {
+			tc.SystemOut = fmt.Sprintf("commit %s", r.CommitSHA)
+			if r.Signature != "" {
+				tc.SystemOut += fmt.Sprintf(", signature %s", r.Signature)
+			}
+		}
+		switch r.Status {
+		case "failed":
+			tc.Failure = &junitFailure{Message: r.Error, Body: r.Error}
+		case "skipped", "rolled_back":
+			tc.Skipped = &junitSkipped{Message: r.Error}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %v", err)
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), data...), 0644)
+}
@@ -1,118 +1,1791 @@
-package main
-
-import (
-	"encoding/csv"
-	"flag"
-	"fmt"
-	"log"
-	"os"
-	"path/filepath"
-	"time"
-
-	git "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-)
-
-func main() {
-	repoPath := flag.String("repo", "", "Path to the local Git repository")
-	scenarioPath := flag.String("scenario", "", "Path to the folder delete scenario CSV file")
-	username := flag.String("username", "", "GitHub username")
-	token := flag.String("token", "", "GitHub personal access token")
-	flag.Parse()
-
-	if *repoPath == "" || *scenarioPath == "" || *username == "" || *token == "" {
-		log.Fatal("All flags --repo, --scenario, --username, and --token are required.")
-	}
-
-	repo, err := git.PlainOpen(*repoPath)
-	if err != nil {
-		log.Fatalf("Failed to open repository: %v", err)
-	}
-
-	worktree, err := repo.Worktree()
-	if err != nil {
-		log.Fatalf("Failed to get worktree: %v", err)
-	}
-
-	file, err := os.Open(*scenarioPath)
-	if err != nil {
-		log.Fatalf("Failed to open scenario CSV: %v", err)
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		log.Fatalf("Failed to read scenario CSV: %v", err)
-	}
-
-	foldersDeleted := 0
-
-	for i, rec := range records {
-		if len(rec) < 2 {
-			log.Printf("Skipping malformed line %d", i+1)
-			continue
-		}
-
-		relativePath, opType := rec[0], rec[1]
-		if opType != "delete" {
-			log.Printf("Skipping non-delete op at line %d", i+1)
-			continue
-		}
-
-		// Use repoPath to construct full filesystem path
-		fullPath := filepath.Join(*repoPath, relativePath)
-
-		// Check if the folder exists
-		if _, statErr := os.Stat(fullPath); os.IsNotExist(statErr) {
-			log.Printf("Folder not found (skipped): %s", fullPath)
-			continue
-		}
-
-		// First, remove all files in the folder from the Git index
-		err = worktree.RemoveGlob(filepath.Join(relativePath, "*"))
-		if err != nil {
-			log.Printf("Failed to remove from Git index: %v", err)
-			continue
-		}
-		// Then delete from filesystem
-		err := os.RemoveAll(fullPath)
-		if err != nil {
-			log.Printf("Failed to delete folder %s: %v", fullPath, err)
-			continue
-		}
-
-		log.Printf("Deleted folder: %s", relativePath)
-		foldersDeleted++
-	}
-
-	if foldersDeleted == 0 {
-		log.Println("No folders deleted. Skipping commit and push.")
-		return
-	}
-
-	commitMsg := fmt.Sprintf("Deleted %d folder(s) as per scenario", foldersDeleted)
-	_, err = worktree.Commit(commitMsg, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  *username,
-			Email: fmt.Sprintf("%s@example.com", *username),
-			When:  time.Now(),
-		},
-	})
-	if err != nil {
-		log.Fatalf("Failed to commit: %v", err)
-	}
-
-	err = repo.Push(&git.PushOptions{
-		Auth: &http.BasicAuth{
-			Username: *username, // this can be anything except empty
-			Password: *token,
-		},
-	})
-	if err != nil {
-		log.Fatalf("Failed to push: %v", err)
-	}
-
-	log.Println("All folder deletions committed and pushed successfully.")
-}
\ No newline at end of file
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	repoPath := flag.String("repo", "", "Path to the local Git repository")
+	scenarioPath := flag.String("scenario", "", "Path to the folder delete scenario CSV file")
+	username := flag.String("username", "", "GitHub username")
+	token := flag.String("token", "", "GitHub personal access token")
+	reportPath := flag.String("report", "", "Path to write the JSON execution report (optional)")
+	junitPath := flag.String("junit", "", "Path to write the JUnit XML execution report (optional)")
+	syncStrategy := flag.String("sync", "rebase", "How to integrate remote changes when a push is rejected: rebase or merge")
+	pushRetries := flag.Int("push-retries", 3, "Number of times to replay the deletions and retry a rejected push")
+	pushBackoff := flag.Duration("push-backoff", 2*time.Second, "Initial wait between push retries (doubled each retry)")
+	retryAttempts := flag.Int("retry-attempts", 3, "Maximum attempts for fetch/push on transient failures")
+	retryBackoff := flag.Duration("retry-backoff", time.Second, "Initial wait before retrying a transient failure")
+	retryMaxBackoff := flag.Duration("retry-max-backoff", 30*time.Second, "Upper bound for the wait between transient retries")
+	retryJitter := flag.Float64("retry-jitter", 0.2, "Random jitter applied to retry waits, as a fraction (0..1)")
+	onError := flag.String("on-error", "continue", "What to do when a line fails: stop, continue or abort-after=N")
+	atomic := flag.Bool("atomic", false, "Push only if every line succeeds; otherwise reset the repository to the pre-run commit")
+	remoteURL := flag.String("remote", "", "Remote URL to clone with --clone-if-missing or --ephemeral")
+	cloneIfMissing := flag.Bool("clone-if-missing", false, "Clone --remote into --repo when it does not exist yet, and keep it")
+	expectedBranch := flag.String("branch", "", "Branch the repository must be on before the run starts (default: any branch)")
+	forceUnlock := flag.Bool("force-unlock", false, "Remove a repository lock left by another executor run, even if it looks alive")
+	skipPreflight := flag.Bool("skip-preflight", false, "Skip the worktree, branch, upstream and remote checks before the run")
+	ephemeral := flag.Bool("ephemeral", false, "Clone --remote into a temporary directory, run there and remove it afterwards; --repo is not touched")
+	signFormat := flag.String("sign", "", "Sign the commit: gpg (default: no signing; SSH signing needs the create/update executor)")
+	signingKeyPath := flag.String("signing-key", "", "ASCII-armored OpenPGP private key file to sign with")
+	signingPassphrase := flag.String("signing-passphrase", "", "Passphrase of --signing-key, if it is encrypted")
+	provenance := flag.String("provenance", "", "Link the commit to its scenario lines: trailers (in the commit message) or notes (in refs/notes/scenario) (default: neither)")
+	runID := flag.String("run-id", "", "Run ID recorded in trailers, notes and the report (default: generated from the start time)")
+	flag.Parse()
+
+	if *repoPath == "" || *scenarioPath == "" || *username == "" || *token == "" {
+		fatalf("All flags --repo, --scenario, --username, and --token are required.")
+	}
+	if *syncStrategy != "rebase" && *syncStrategy != "merge" {
+		fatalf("Invalid --sync value %q: must be 'rebase' or 'merge'", *syncStrategy)
+	}
+	failurePolicy, err := parseFailurePolicy(*onError)
+	if err != nil {
+		fatalf("Invalid --on-error value: %v", err)
+	}
+	if (*cloneIfMissing || *ephemeral) && *remoteURL == "" {
+		fatalf("--clone-if-missing and --ephemeral need --remote.")
+	}
+	if *provenance != "" && *provenance != "trailers" && *provenance != "notes" {
+		fatalf("Invalid --provenance value %q: must be 'trailers' or 'notes'", *provenance)
+	}
+	if *runID == "" {
+		*runID = newRunID()
+	}
+	var signKey *openpgp.Entity
+	if *signFormat != "" {
+		if *signFormat != "gpg" {
+			fatalf("Invalid --sign value %q: this executor signs with OpenPGP keys only ('gpg')", *signFormat)
+		}
+		if *signingKeyPath == "" {
+			fatalf("--sign gpg needs --signing-key.")
+		}
+		if signKey, err = readSigningKey(*signingKeyPath, *signingPassphrase); err != nil {
+			fatalf("Failed to read signing key: %v", err)
+		}
+	}
+
+	auth := &http.BasicAuth{
+		Username: *username, // this can be anything except empty
+		Password: *token,
+	}
+	policy := PushPolicy{
+		Strategy: *syncStrategy,
+		Retries:  *pushRetries,
+		Backoff:  *pushBackoff,
+		Transient: RetryPolicy{
+			MaxAttempts:    *retryAttempts,
+			InitialBackoff: *retryBackoff,
+			MaxBackoff:     *retryMaxBackoff,
+			Jitter:         *retryJitter,
+		},
+		SignKey: signKey,
+	}
+
+	// --repo names the repository in reports and repo columns; workDir is where the run
+	// happens, which differs from --repo for an ephemeral clone
+	workDir, err := prepareWorkspace(*repoPath, *remoteURL, *ephemeral, *cloneIfMissing, auth, policy.Transient)
+	if err != nil {
+		fatalf("Failed to prepare workspace: %v", err)
+	}
+
+	repo, err := git.PlainOpen(workDir)
+	if err != nil {
+		fatalf("Failed to open repository: %v", err)
+	}
+
+	// Hold the lock until the run ends, so no other executor uses this clone meanwhile
+	if err := acquireLock(repo, *scenarioPath, *forceUnlock); err != nil {
+		fatalf("%v", err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		fatalf("Failed to get worktree: %v", err)
+	}
+
+	// Fail before the first row if the repository is not safe to run in, listing every
+	// problem at once
+	if !*skipPreflight {
+		problems := preflight(repo, worktree, *expectedBranch, auth, policy.Transient)
+		for _, problem := range problems {
+			log.Printf("Preflight failed: %s", problem)
+		}
+		if len(problems) > 0 {
+			fatalf("No scenario line was executed. Fix the problems above or pass --skip-preflight.")
+		}
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		fatalf("Failed to read HEAD: %v", err)
+	}
+	baseCommit := head.Hash()
+	if *atomic {
+		// One failure rolls everything back, so there is no point in running the rest
+		failurePolicy = FailurePolicy{Mode: "stop", MaxFailures: 1}
+		*onError = "stop"
+	}
+
+	records, lines, err := readScenarioRecords(*scenarioPath)
+	if err != nil {
+		fatalf("Failed to read scenario: %v", err)
+	}
+
+	report := ExecutionReport{
+		Executor:   "folder-delete",
+		Repository: *repoPath,
+		Scenario:   *scenarioPath,
+		StartedAt:  time.Now(),
+		Total:      len(records),
+		Atomic:     *atomic,
+		Signing:    *signFormat,
+		RunID:      *runID,
+	}
+
+	foldersDeleted := 0
+
+	for i, rec := range records {
+		if failures := countStatus(report.Results, "failed"); failurePolicy.shouldStop(failures) {
+			log.Printf("Stopping after %d failed line(s) (--on-error %s)", failures, *onError)
+			report.Results = append(report.Results, notExecuted(records[i:], lines[i:])...)
+			break
+		}
+
+		result := OperationResult{LineNumber: lines[i], StartedAt: time.Now()}
+		if len(rec) > 0 {
+			result.FilePath = rec[0]
+		}
+		if len(rec) > 1 {
+			result.OperationType = rec[1]
+		}
+		if len(rec) > 2 {
+			result.CommitMessage = rec[2]
+		}
+
+		if len(rec) < 2 {
+			log.Printf("Skipping malformed line %d", lines[i])
+			report.Results = append(report.Results, failResult(result, fmt.Errorf("malformed line")))
+			continue
+		}
+
+		relativePath, opType := rec[0], rec[1]
+		if opType != "delete" {
+			log.Printf("Skipping non-delete op at line %d", lines[i])
+			report.Results = append(report.Results, skipResult(result, "non-delete operation"))
+			continue
+		}
+
+		// Multi-repository scenarios are run by the create/update executor; here only rows
+		// for this repository are applied
+		if len(rec) > 6 && strings.TrimSpace(rec[6]) != "" && !sameRepository(rec[6], *repoPath) {
+			log.Printf("Skipping line %d for repository %s", lines[i], rec[6])
+			report.Results = append(report.Results, skipResult(result, fmt.Sprintf("row targets repository %s", rec[6])))
+			continue
+		}
+
+		// Use repoPath to construct full filesystem path
+		fullPath := filepath.Join(workDir, relativePath)
+
+		// Check if the folder exists
+		if _, statErr := os.Stat(fullPath); os.IsNotExist(statErr) {
+			log.Printf("Folder not found (skipped): %s", fullPath)
+			report.Results = append(report.Results, skipResult(result, "folder not found"))
+			continue
+		}
+
+		// Collect the tracked files before they disappear, for the report
+		touched := trackedFilesUnder(repo, relativePath)
+
+		// First, remove all files in the folder from the Git index
+		err = worktree.RemoveGlob(filepath.Join(relativePath, "*"))
+		if err != nil {
+			log.Printf("Failed to remove from Git index: %v", err)
+			report.Results = append(report.Results, failResult(result, fmt.Errorf("failed to remove from Git index: %v", err)))
+			continue
+		}
+		// Then delete from filesystem
+		err := os.RemoveAll(fullPath)
+		if err != nil {
+			log.Printf("Failed to delete folder %s: %v", fullPath, err)
+			report.Results = append(report.Results, failResult(result, fmt.Errorf("failed to delete folder %s: %v", relativePath, err)))
+			continue
+		}
+
+		log.Printf("Deleted folder: %s", relativePath)
+		foldersDeleted++
+		result.Status = "success"
+		result.FilesTouched = touched
+		result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+		report.Results = append(report.Results, result)
+	}
+
+	if *atomic && countStatus(report.Results, "failed") > 0 {
+		if err := rollback(repo, worktree, baseCommit, &report, "another line failed"); err != nil {
+			writeReports(&report, *reportPath, *junitPath)
+			fatalf("Rollback failed, repository may need manual cleanup: %v", err)
+		}
+		finish(&report, *reportPath, *junitPath)
+		return
+	}
+
+	if foldersDeleted == 0 {
+		log.Println("No folders deleted. Skipping commit and push.")
+		finish(&report, *reportPath, *junitPath)
+		return
+	}
+
+	commitMsg := fmt.Sprintf("Deleted %d folder(s) as per scenario", foldersDeleted)
+	var appliedLines []int
+	for _, r := range report.Results {
+		if r.Status == "success" {
+			appliedLines = append(appliedLines, r.LineNumber)
+		}
+	}
+	if *provenance == "trailers" {
+		commitMsg += "\n\n" + strings.Join(provenanceLines(*scenarioPath, appliedLines, *runID), "\n")
+	}
+	author := &object.Signature{
+		Name:  *username,
+		Email: fmt.Sprintf("%s@example.com", *username),
+		When:  time.Now(),
+	}
+	commitHash, err := worktree.Commit(commitMsg, &git.CommitOptions{
+		Author:  author,
+		SignKey: signKey,
+	})
+	if err != nil {
+		markBatchFailed(&report, fmt.Errorf("failed to commit: %v", err))
+		writeReports(&report, *reportPath, *junitPath)
+		fatalf("Failed to commit: %v", err)
+	}
+	setBatchCommit(&report, commitHash.String())
+
+	err = pushWithRetry(repo, worktree, workDir, auth, &report, commitHash, commitMsg, author, policy)
+	if err != nil && *atomic {
+		if rbErr := rollback(repo, worktree, baseCommit, &report, "push failed"); rbErr != nil {
+			log.Printf("Rollback failed, repository may need manual cleanup: %v", rbErr)
+		}
+	}
+	if err != nil {
+		markBatchFailed(&report, fmt.Errorf("failed to push: %v", err))
+		writeReports(&report, *reportPath, *junitPath)
+		fatalf("Failed to push: %v", err)
+	}
+
+	log.Println("All folder deletions committed and pushed successfully.")
+	if *provenance == "notes" {
+		note := strings.Join(provenanceLines(*scenarioPath, appliedLines, *runID), "\n")
+		if err := writeProvenanceNotes(repo, auth, &report, note, author, policy); err != nil {
+			writeReports(&report, *reportPath, *junitPath)
+			fatalf("Failed to write provenance notes: %v", err)
+		}
+	}
+	if signKey != nil {
+		verifySignatures(repo, &report, signKey)
+	}
+	finish(&report, *reportPath, *junitPath)
+}
+
+// trackedFilesUnder lists the files in the Git index below dir.
+func trackedFilesUnder(repo *git.Repository, dir string) []string {
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil
+	}
+
+	prefix := filepath.ToSlash(filepath.Clean(dir)) + "/"
+	var files []string
+	for _, entry := range idx.Entries {
+		if strings.HasPrefix(entry.Name, prefix) {
+			files = append(files, entry.Name)
+		}
+	}
+	return files
+}
+
+// Exit codes shared by all executors
+const (
+	exitSuccess        = 0 // every scenario line succeeded
+	exitPartialFailure = 1 // the run finished (or was stopped by --on-error) with failed lines
+	exitFatal          = 2 // the run could not start or could not be completed
+)
+
+func fatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	cleanupWorkspace()
+	os.Exit(exitFatal)
+}
+
+// lockFileName is shared by all executors, so none of them runs in a clone another one
+// is using.
+const lockFileName = "scenario-executor.lock"
+
+// ExecutorLock is the content of the advisory lock file an executor holds while it runs.
+type ExecutorLock struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	Executor  string    `json:"executor"`
+	Scenario  string    `json:"scenario"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// heldLock is the lock file this run created, released by cleanupWorkspace.
+var heldLock string
+
+// acquireLock creates the lock file in the repository's git directory. A lock left by a
+// process on this host that is no longer running is stale and replaced; force replaces
+// any lock. A live lock is an error that says who holds it.
+func acquireLock(repo *git.Repository, scenarioFile string, force bool) error {
+	storage, ok := repo.Storer.(*filesystem.Storage)
+	if !ok {
+		return fmt.Errorf("repository has no git directory to lock")
+	}
+	path := filepath.Join(storage.Filesystem().Root(), lockFileName)
+
+	host, _ := os.Hostname()
+	data, _ := json.MarshalIndent(ExecutorLock{PID: os.Getpid(), Host: host, Executor: "folder-delete", Scenario: scenarioFile, StartedAt: time.Now()}, "", "  ")
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.Write(data)
+			file.Close()
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("failed to write lock file %s: %v", path, err)
+			}
+			heldLock = path
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to create lock file %s: %v", path, err)
+		}
+
+		var holder ExecutorLock
+		content, _ := os.ReadFile(path)
+		if json.Unmarshal(content, &holder) != nil {
+			holder = ExecutorLock{}
+		}
+		switch {
+		case force:
+			log.Printf("--force-unlock removes the lock held by pid %d on %s since %s", holder.PID, holder.Host, holder.StartedAt.Format(time.RFC3339))
+		case holder.Host == host && holder.PID > 0 && !processAlive(holder.PID):
+			log.Printf("Removing stale lock of pid %d, which is no longer running", holder.PID)
+		default:
+			return fmt.Errorf("repository is locked by %s (pid %d on %s, scenario %s) since %s; wait for it to finish or pass --force-unlock if it is gone", holder.Executor, holder.PID, holder.Host, holder.Scenario, holder.StartedAt.Format(time.RFC3339))
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove lock file %s: %v", path, err)
+		}
+	}
+	return fmt.Errorf("lock file %s was re-created by another executor", path)
+}
+
+// processAlive reports whether a process with this PID is running on this host.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true // FindProcess only succeeds for running processes
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// preflight checks that the repository is safe to run in: no uncommitted changes to
+// tracked files (the deletion commit would sweep them in), the expected branch with an
+// upstream, and an origin that answers with the configured credentials. It returns every
+// problem found.
+func preflight(repo *git.Repository, worktree *git.Worktree, expectedBranch string, auth *http.BasicAuth, retry RetryPolicy) []string {
+	var problems []string
+
+	if status, err := worktree.Status(); err != nil {
+		problems = append(problems, fmt.Sprintf("cannot read worktree status: %v", err))
+	} else {
+		var dirty []string
+		for path, s := range status {
+			if s.Worktree != git.Untracked && (s.Staging != git.Unmodified || s.Worktree != git.Unmodified) {
+				dirty = append(dirty, path)
+			}
+		}
+		if len(dirty) > 0 {
+			sort.Strings(dirty)
+			problems = append(problems, fmt.Sprintf("worktree has uncommitted changes to %d path(s), e.g. %q; commit or stash them first", len(dirty), dirty[0]))
+		}
+	}
+
+	head, err := repo.Head()
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("cannot read HEAD: %v", err))
+	case !head.Name().IsBranch():
+		problems = append(problems, "HEAD is detached; check out a branch first")
+	case expectedBranch != "" && head.Name().Short() != expectedBranch:
+		problems = append(problems, fmt.Sprintf("on branch %s, expected %s (--branch)", head.Name().Short(), expectedBranch))
+	default:
+		branch := head.Name().Short()
+		if cfg, err := repo.Config(); err != nil || cfg.Branches[branch] == nil || cfg.Branches[branch].Remote == "" {
+			problems = append(problems, fmt.Sprintf("branch %s has no upstream; set one with git branch --set-upstream-to=origin/%s", branch, branch))
+		}
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return append(problems, fmt.Sprintf("no origin remote: %v", err))
+	}
+	err = withRetry(retry, "ls-remote", func() error {
+		_, err := remote.List(&git.ListOptions{Auth: auth})
+		return err
+	})
+	switch {
+	case err == nil, errors.Is(err, transport.ErrEmptyRemoteRepository):
+	case errors.Is(err, transport.ErrAuthenticationRequired), errors.Is(err, transport.ErrAuthorizationFailed), errors.Is(err, transport.ErrInvalidAuthMethod):
+		problems = append(problems, fmt.Sprintf("origin rejected the credentials, check --username and --token: %v", err))
+	default:
+		problems = append(problems, fmt.Sprintf("origin is not reachable: %v", err))
+	}
+	return problems
+}
+
+// ephemeralClone is the temporary directory of an --ephemeral run, removed when the run
+// ends however it ends.
+var ephemeralClone string
+
+// prepareWorkspace returns the directory to run in. With ephemeral, remoteURL is cloned
+// into a new temporary directory; with cloneIfMissing, it is cloned into a missing
+// repoPath, which is kept for later runs. Otherwise repoPath is used as it is.
+func prepareWorkspace(repoPath, remoteURL string, ephemeral, cloneIfMissing bool, auth *http.BasicAuth, retry RetryPolicy) (string, error) {
+	dir := repoPath
+	if ephemeral {
+		tmp, err := os.MkdirTemp("", "scenario-workspace-")
+		if err != nil {
+			return "", fmt.Errorf("failed to create temporary workspace: %v", err)
+		}
+		ephemeralClone = tmp
+		dir = tmp
+	} else if _, err := os.Stat(repoPath); !cloneIfMissing || !os.IsNotExist(err) {
+		return repoPath, nil
+	}
+
+	log.Printf("Cloning %s into %s", remoteURL, dir)
+	err := withRetry(retry, "clone", func() error {
+		_, err := git.PlainClone(dir, false, &git.CloneOptions{URL: remoteURL, Auth: auth})
+		if err != nil {
+			os.RemoveAll(dir) // a failed clone leaves a partial repository behind
+		}
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to clone %s: %v", remoteURL, err)
+	}
+	return dir, nil
+}
+
+// cleanupWorkspace releases the repository lock and removes an --ephemeral clone.
+func cleanupWorkspace() {
+	if heldLock != "" {
+		os.Remove(heldLock)
+		heldLock = ""
+	}
+	if ephemeralClone != "" {
+		os.RemoveAll(ephemeralClone)
+	}
+}
+
+// FailurePolicy decides when a run stops after failed lines. MaxFailures of 0 means never.
+type FailurePolicy struct {
+	Mode        string // "stop", "continue" or "abort-after"
+	MaxFailures int
+}
+
+func (p FailurePolicy) shouldStop(failures int) bool {
+	return p.MaxFailures > 0 && failures >= p.MaxFailures
+}
+
+// parseFailurePolicy accepts "stop", "continue" or "abort-after=N".
+func parseFailurePolicy(value string) (FailurePolicy, error) {
+	switch {
+	case value == "stop":
+		return FailurePolicy{Mode: "stop", MaxFailures: 1}, nil
+	case value == "continue":
+		return FailurePolicy{Mode: "continue"}, nil
+	case strings.HasPrefix(value, "abort-after="):
+		n, err := strconv.Atoi(strings.TrimPrefix(value, "abort-after="))
+		if err != nil || n < 1 {
+			return FailurePolicy{}, fmt.Errorf("invalid failure count in %q", value)
+		}
+		return FailurePolicy{Mode: "abort-after", MaxFailures: n}, nil
+	}
+	return FailurePolicy{}, fmt.Errorf("must be 'stop', 'continue' or 'abort-after=N', got %q", value)
+}
+
+// ScenarioDocument is the YAML/JSON form of a scenario. Operations map onto the CSV
+// columns; content is taken verbatim, so multi-line content needs no "@file:" reference.
+// Vars are defaults for "${name}" placeholders and can be overridden by an include.
+type ScenarioDocument struct {
+	Format     int                 `json:"format,omitempty" yaml:"format,omitempty"`
+	Vars       map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Operations []DocumentOperation `json:"operations" yaml:"operations"`
+}
+
+// DocumentOperation is one entry of a ScenarioDocument: an operation, an include of
+// another document, or a for loop over Do. Expansion leaves only operations.
+type DocumentOperation struct {
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	Op          string `json:"op,omitempty" yaml:"op,omitempty"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+	Content     string `json:"content,omitempty" yaml:"content,omitempty"`
+	ContentFile string `json:"content_file,omitempty" yaml:"content_file,omitempty"` // relative to the scenario
+	Author      string `json:"author,omitempty" yaml:"author,omitempty"`
+	Target      string `json:"target,omitempty" yaml:"target,omitempty"`
+	Repo        string `json:"repo,omitempty" yaml:"repo,omitempty"` // repository name or path, for multi-repository runs
+	Time        string `json:"time,omitempty" yaml:"time,omitempty"` // RFC 3339 time of the operation, for time-scaled replay
+
+	Include string              `json:"include,omitempty" yaml:"include,omitempty"` // document to splice in, relative to this one
+	Vars    map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`       // extra variables for the include or loop body
+	For     string              `json:"for,omitempty" yaml:"for,omitempty"`         // loop variable name
+	In      []string            `json:"in,omitempty" yaml:"in,omitempty"`           // values to loop over
+	Range   string              `json:"range,omitempty" yaml:"range,omitempty"`     // or an integer range "first..last"
+	Pad     int                 `json:"pad,omitempty" yaml:"pad,omitempty"`         // zero-pad range values to this width
+	Do      []DocumentOperation `json:"do,omitempty" yaml:"do,omitempty"`
+
+	Line   int    `json:"-" yaml:"-"`
+	Origin string `json:"-" yaml:"-"` // file:line and loop values the operation was expanded from
+}
+
+// placeholder matches "${name}", and "$${name}", which stands for a literal "${name}".
+var placeholder = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isScenarioDocument reports whether the file extension selects the YAML or JSON format.
+func isScenarioDocument(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readScenarioDocument loads a YAML or JSON scenario and expands its includes, loops and
+// variables. Each operation keeps the line it was written on and an Origin naming the
+// file and loop values, and content_file references are read into Content.
+func readScenarioDocument(filename string) ([]DocumentOperation, error) {
+	return expandDocument(filename, nil, "", nil)
+}
+
+func expandDocument(filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, included := range stack {
+		if included == abs {
+			return nil, fmt.Errorf("include cycle: %s is already being expanded", filename)
+		}
+	}
+
+	doc, err := loadScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables passed by an include win over the document's defaults
+	scope := make(map[string]string)
+	for name, value := range doc.Vars {
+		scope[name] = value
+	}
+	for name, value := range vars {
+		scope[name] = value
+	}
+	return expandItems(doc.Operations, filename, scope, bindings, append(stack, abs))
+}
+
+func expandItems(items []DocumentOperation, filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	var ops []DocumentOperation
+	for _, item := range items {
+		where := fmt.Sprintf("%s:%d", filename, item.Line)
+		scope, err := withVars(vars, item.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+
+		switch {
+		case item.Include != "" && item.For != "":
+			return nil, fmt.Errorf("%s: an entry cannot be both an include and a for loop", where)
+		case item.Include != "" || item.For != "":
+			if item.Path != "" || item.Op != "" {
+				return nil, fmt.Errorf("%s: include and for entries cannot also be operations", where)
+			}
+		}
+
+		switch {
+		case item.Include != "":
+			name, err := substitute(item.Include, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(filename), name)
+			}
+			included, err := expandDocument(name, scope, bindings, stack)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			ops = append(ops, included...)
+
+		case item.For != "":
+			values, err := loopValues(item, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			for _, value := range values {
+				body := make(map[string]string, len(scope)+1)
+				for name, v := range scope {
+					body[name] = v
+				}
+				body[item.For] = value
+				expanded, err := expandItems(item.Do, filename, body, fmt.Sprintf("%s %s=%s", bindings, item.For, value), stack)
+				if err != nil {
+					return nil, err
+				}
+				ops = append(ops, expanded...)
+			}
+
+		default:
+			op, err := expandOperation(item, filename, scope, stack[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			op.Origin = where
+			if bindings != "" {
+				op.Origin += " [" + strings.TrimSpace(bindings) + "]"
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// expandOperation fills in the placeholders of one operation and loads its content_file.
+// The content_file reference is rewritten relative to the top-level document.
+func expandOperation(item DocumentOperation, filename string, vars map[string]string, topLevel string) (DocumentOperation, error) {
+	op := DocumentOperation{Line: item.Line}
+	fields := []struct {
+		from string
+		to   *string
+	}{
+		{item.Path, &op.Path}, {item.Op, &op.Op}, {item.Message, &op.Message}, {item.Content, &op.Content},
+		{item.ContentFile, &op.ContentFile}, {item.Author, &op.Author}, {item.Target, &op.Target}, {item.Repo, &op.Repo}, {item.Time, &op.Time},
+	}
+	for _, field := range fields {
+		value, err := substitute(field.from, vars)
+		if err != nil {
+			return op, err
+		}
+		*field.to = value
+	}
+
+	if op.Path == "" || op.Op == "" {
+		return op, fmt.Errorf("operation needs a path and an op")
+	}
+	if op.ContentFile == "" {
+		return op, nil
+	}
+	if op.Content != "" {
+		return op, fmt.Errorf("operation has both content and content_file")
+	}
+	contentPath := op.ContentFile
+	if !filepath.IsAbs(contentPath) {
+		contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+		if abs, err := filepath.Abs(contentPath); err == nil {
+			if rel, err := filepath.Rel(filepath.Dir(topLevel), abs); err == nil {
+				op.ContentFile = filepath.ToSlash(rel)
+			}
+		}
+	}
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		return op, fmt.Errorf("failed to read content_file: %v", err)
+	}
+	op.Content = string(content)
+	return op, nil
+}
+
+// withVars returns vars extended by extra, whose values may use the variables in vars.
+func withVars(vars, extra map[string]string) (map[string]string, error) {
+	if len(extra) == 0 {
+		return vars, nil
+	}
+	scope := make(map[string]string, len(vars)+len(extra))
+	for name, value := range vars {
+		scope[name] = value
+	}
+	for name, value := range extra {
+		expanded, err := substitute(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		scope[name] = expanded
+	}
+	return scope, nil
+}
+
+// loopValues returns the values of a for loop: the "in" list, or the "range" first..last
+// zero-padded to "pad" digits.
+func loopValues(item DocumentOperation, vars map[string]string) ([]string, error) {
+	if (len(item.In) > 0) == (item.Range != "") {
+		return nil, fmt.Errorf("for %s needs exactly one of \"in\" and \"range\"", item.For)
+	}
+
+	var values []string
+	for _, v := range item.In {
+		value, err := substitute(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if item.Range == "" {
+		return values, nil
+	}
+
+	bounds, err := substitute(item.Range, vars)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(bounds, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("range must look like <first>..<last>, got %q", bounds)
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	last, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || last < first {
+		return nil, fmt.Errorf("invalid range %q", bounds)
+	}
+	for n := first; n <= last; n++ {
+		values = append(values, fmt.Sprintf("%0*d", item.Pad, n))
+	}
+	return values, nil
+}
+
+// substitute replaces "${name}" placeholders; an undefined variable is an error.
+// "$${name}" is kept as a literal "${name}".
+func substitute(s string, vars map[string]string) (string, error) {
+	var missing []string
+	result := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable ${%s}", missing[0])
+	}
+	return result, nil
+}
+
+// loadScenarioDocument decodes one YAML or JSON file, rejecting unknown fields, and
+// records the line every entry starts on.
+func loadScenarioDocument(filename string) (ScenarioDocument, error) {
+	var doc ScenarioDocument
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return doc, err
+	}
+
+	isJSON := strings.ToLower(filepath.Ext(filename)) == ".json"
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid JSON scenario %s: %v", filename, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid YAML scenario %s: %v", filename, err)
+		}
+	}
+	if doc.Format != 0 && doc.Format != currentFormatVersion {
+		return doc, fmt.Errorf("unsupported scenario format %d in %s (YAML and JSON scenarios use format %d)", doc.Format, filename, currentFormatVersion)
+	}
+
+	// JSON is read through the YAML parser too, just for line numbers; if that fails
+	// (e.g. tab indentation) only top-level entries get exact lines
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err == nil && root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		assignLines(doc.Operations, mappingValue(root.Content[0], "operations"), 0)
+	} else if isJSON {
+		for i, line := range jsonOperationLines(data) {
+			if i < len(doc.Operations) {
+				assignLines(doc.Operations[i:i+1], nil, line)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// assignLines copies the line of every sequence element onto items, recursing into
+// "do"; without a node the items inherit parentLine.
+func assignLines(items []DocumentOperation, seq *yaml.Node, parentLine int) {
+	for i := range items {
+		items[i].Line = parentLine
+		var node *yaml.Node
+		if seq != nil && seq.Kind == yaml.SequenceNode && i < len(seq.Content) {
+			node = seq.Content[i]
+			items[i].Line = node.Line
+		}
+		assignLines(items[i].Do, mappingValue(node, "do"), items[i].Line)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// jsonOperationLines returns the line each element of the top-level "operations" array starts on.
+func jsonOperationLines(data []byte) []int {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		var skip json.RawMessage
+		if key != "operations" {
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+			continue
+		}
+		if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil
+		}
+		var lines []int
+		for decoder.More() {
+			// InputOffset is just past the previous token; skip to the element itself
+			offset := int(decoder.InputOffset())
+			for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+				offset++
+			}
+			lines = append(lines, 1+bytes.Count(data[:offset], []byte("\n")))
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+// currentFormatVersion is the scenario format written by the tools in this repository.
+// Version 1 is the original headerless layout; version 2 starts with a
+// "#scenario-format: 2" line followed by a header row, and an update without content
+// writes an empty file instead of the "test data" placeholder.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
+
+// parseFormatMarker reports whether record is a "#scenario-format: N" line and returns N.
+func parseFormatMarker(record []string) (int, bool, error) {
+	if len(record) != 1 || !strings.HasPrefix(strings.TrimSpace(record[0]), formatMarker) {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), formatMarker)))
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid format marker %q", record[0])
+	}
+	if version > currentFormatVersion {
+		return version, true, fmt.Errorf("scenario format %d is newer than this tool supports (%d)", version, currentFormatVersion)
+	}
+	return version, true, nil
+}
+
+// scenarioColumns is the legacy positional layout. A header row may name these columns
+// in any order; files without one keep using the positions.
+var scenarioColumns = []string{"path", "op", "message", "content", "author", "target", "repo", "time"}
+
+// columnAliases are alternative header spellings.
+var columnAliases = map[string]string{
+	"operation":   "op",
+	"file":        "path",
+	"commit":      "message",
+	"target_path": "target",
+	"repository":  "repo",
+}
+
+// parseHeader reports whether record is a header row (it names both "path" and "op") and
+// returns, for every entry of scenarioColumns, the index it appears at or -1. Unknown
+// column names are an error so that a typo does not silently drop data; columns starting
+// with "x-" are free-form and ignored.
+func parseHeader(record []string) ([]int, bool, error) {
+	names := make([]string, len(record))
+	isHeader := map[string]bool{}
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		names[i] = name
+		isHeader[name] = true
+	}
+	if !isHeader["path"] || !isHeader["op"] {
+		return nil, false, nil
+	}
+
+	positions := make([]int, len(scenarioColumns))
+	for i := range positions {
+		positions[i] = -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		column := -1
+		for j, known := range scenarioColumns {
+			if name == known {
+				column = j
+			}
+		}
+		if column < 0 {
+			return nil, true, fmt.Errorf("unknown column %q in header (known: %s; prefix custom columns with x-)", record[i], strings.Join(scenarioColumns, ", "))
+		}
+		if positions[column] >= 0 {
+			return nil, true, fmt.Errorf("column %q appears more than once in header", name)
+		}
+		positions[column] = i
+	}
+	if positions[2] < 0 {
+		return nil, true, fmt.Errorf("header has no %q column", "message")
+	}
+	return positions, true, nil
+}
+
+// reorderRecord returns record in the legacy positional layout described by positions.
+func reorderRecord(record []string, positions []int) []string {
+	var reordered []string
+	for column, index := range positions {
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		for len(reordered) < column {
+			reordered = append(reordered, "")
+		}
+		reordered = append(reordered, record[index])
+	}
+	return reordered
+}
+
+// readScenarioRecords returns the scenario rows in column order (path, op, message, ...) with
+// the line each one starts on. .yaml, .yml and .json files are read as documents.
+func readScenarioRecords(filename string) ([][]string, []int, error) {
+	var records [][]string
+	var lines []int
+
+	if isScenarioDocument(filename) {
+		ops, err := readScenarioDocument(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, op := range ops {
+			records = append(records, []string{op.Path, op.Op, op.Message, "", "", "", op.Repo})
+			lines = append(lines, op.Line)
+		}
+		return records, lines, nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // the format marker is a single field
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+
+	// An optional format marker and header row come first
+	version := 1
+	if len(records) > 0 {
+		v, isMarker, err := parseFormatMarker(records[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		if isMarker {
+			version = v
+			records, lines = records[1:], lines[1:]
+		}
+	}
+	if len(records) > 0 {
+		positions, isHeader, err := parseHeader(records[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid header at line %d: %v", lines[0], err)
+		}
+		if isHeader {
+			records, lines = records[1:], lines[1:]
+			for i := range records {
+				records[i] = reorderRecord(records[i], positions)
+			}
+		} else if version >= 2 {
+			return nil, nil, fmt.Errorf("scenario format %d requires a header row at line %d", version, lines[0])
+		}
+	}
+	return records, lines, nil
+}
+
+// sameRepository reports whether a repo column value names the repository at repoPath.
+func sameRepository(repo, repoPath string) bool {
+	a, errA := filepath.Abs(strings.TrimSpace(repo))
+	b, errB := filepath.Abs(repoPath)
+	return errA == nil && errB == nil && a == b
+}
+
+// notExecuted reports the rows left over when the failure policy stops the run.
+func notExecuted(records [][]string, lines []int) []OperationResult {
+	var results []OperationResult
+	for i, rec := range records {
+		result := OperationResult{LineNumber: lines[i], Status: "skipped", Error: "not executed: run stopped by --on-error policy"}
+		if len(rec) > 0 {
+			result.FilePath = rec[0]
+		}
+		if len(rec) > 1 {
+			result.OperationType = rec[1]
+		}
+		if len(rec) > 2 {
+			result.CommitMessage = rec[2]
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func countStatus(results []OperationResult, status string) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// finish writes the reports and exits with exitPartialFailure if any line failed.
+func finish(report *ExecutionReport, reportPath, junitPath string) {
+	writeReports(report, reportPath, junitPath)
+	cleanupWorkspace()
+	if report.Failed > 0 {
+		log.Printf("%d of %d line(s) failed.", report.Failed, report.Total)
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// PushPolicy controls how a rejected push is retried.
+type PushPolicy struct {
+	Strategy  string // "rebase" or "merge"
+	Retries   int
+	Backoff   time.Duration
+	Transient RetryPolicy     // applied to every fetch and push
+	SignKey   *openpgp.Entity // signs the commit made when the deletions are replayed
+}
+
+// pushWithRetry pushes the deletion commit. If the remote moved on in the meantime
+// (non-fast-forward), the remote branch is fetched, the scenario's deletions are
+// replayed on top of it and the push is retried with exponential backoff.
+func pushWithRetry(repo *git.Repository, worktree *git.Worktree, repoPath string, auth *http.BasicAuth, report *ExecutionReport, commitHash plumbing.Hash, commitMsg string, author *object.Signature, policy PushPolicy) error {
+	// Every retry starts from the scenario commit as it was made locally, so that a
+	// conflict can put the clone back on it and the replay always compares against the
+	// tree the scenario was applied to
+	scenarioCommit, err := repo.CommitObject(commitHash)
+	if err != nil {
+		return fmt.Errorf("failed to load local commit: %v", err)
+	}
+	baseHash := scenarioCommit.ParentHashes[0]
+
+	backoff := policy.Backoff
+	for attempt := 0; ; attempt++ {
+		err := withRetry(policy.Transient, "push", func() error {
+			return repo.Push(&git.PushOptions{Auth: auth})
+		})
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			return nil
+		}
+		if !errors.Is(err, git.ErrNonFastForwardUpdate) && !strings.Contains(err.Error(), "non-fast-forward") {
+			return err
+		}
+		if attempt >= policy.Retries {
+			return fmt.Errorf("push still rejected after %d retries: %v", policy.Retries, err)
+		}
+
+		log.Printf("Push rejected (non-fast-forward), retry %d/%d in %s using %s", attempt+1, policy.Retries, backoff, policy.Strategy)
+		time.Sleep(backoff)
+		backoff *= 2
+
+		head, err := repo.Head()
+		if err != nil {
+			return fmt.Errorf("failed to read HEAD: %v", err)
+		}
+		err = withRetry(policy.Transient, "fetch", func() error {
+			return repo.Fetch(&git.FetchOptions{RemoteName: "origin", Auth: auth})
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return fmt.Errorf("failed to fetch origin: %v", err)
+		}
+		remoteRef, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", head.Name().Short()), true)
+		if err != nil {
+			return fmt.Errorf("failed to resolve origin/%s: %v", head.Name().Short(), err)
+		}
+
+		// Start again from the remote tip and re-apply the rows that succeeded
+		err = worktree.Reset(&git.ResetOptions{Commit: remoteRef.Hash(), Mode: git.HardReset})
+		if err != nil {
+			return fmt.Errorf("failed to reset to origin/%s: %v", head.Name().Short(), err)
+		}
+		replayed, err := replayDeletions(repo, worktree, repoPath, report, baseHash, remoteRef.Hash())
+		if err != nil {
+			if rerr := worktree.Reset(&git.ResetOptions{Commit: scenarioCommit.Hash, Mode: git.HardReset}); rerr != nil {
+				log.Printf("Failed to restore the scenario commit %s: %v", scenarioCommit.Hash, rerr)
+			}
+			return err
+		}
+		if replayed == 0 {
+			log.Println("All deletions are already present on the remote. Nothing left to push.")
+			return nil
+		}
+
+		// A rebase replaces the scenario commit; a merge keeps it as the first parent,
+		// and the report points at it rather than at the merge
+		parents := []plumbing.Hash{remoteRef.Hash()}
+		message := commitMsg
+		if policy.Strategy == "merge" {
+			parents = []plumbing.Hash{scenarioCommit.Hash, remoteRef.Hash()}
+			message = fmt.Sprintf("Merge origin/%s: %s", head.Name().Short(), commitMsg)
+		}
+		commitHash, err = worktree.Commit(message, &git.CommitOptions{Author: author, Parents: parents, SignKey: policy.SignKey})
+		if err != nil {
+			return fmt.Errorf("failed to commit replayed deletions: %v", err)
+		}
+		if policy.Strategy == "merge" {
+			setBatchCommit(report, scenarioCommit.Hash.String())
+		} else {
+			setBatchCommit(report, commitHash.String())
+		}
+	}
+}
+
+// replayDeletions re-applies every successful row on top of the remote tip. A row whose
+// path changed on the remote since our base is a conflict and stops the run; a path that
+// is already gone on the remote is marked as skipped.
+func replayDeletions(repo *git.Repository, worktree *git.Worktree, repoPath string, report *ExecutionReport, baseHash, remoteHash plumbing.Hash) (int, error) {
+	baseTree, err := treeAt(repo, baseHash)
+	if err != nil {
+		return 0, err
+	}
+	remoteTree, err := treeAt(repo, remoteHash)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for i := range report.Results {
+		r := &report.Results[i]
+		if r.Status != "success" {
+			continue
+		}
+
+		after, err := remoteTree.FindEntry(r.FilePath)
+		if err != nil {
+			r.Status = "skipped"
+			r.Error = "already deleted on remote"
+			r.CommitSHA = ""
+			continue
+		}
+		before, err := baseTree.FindEntry(r.FilePath)
+		if err == nil && before.Hash != after.Hash {
+			r.Status = "failed"
+			r.Error = "conflict: modified on remote since the scenario was applied"
+			r.CommitSHA = ""
+			return replayed, fmt.Errorf("conflict at line %d: %s was modified on the remote", r.LineNumber, r.FilePath)
+		}
+
+		if err := worktree.RemoveGlob(filepath.Join(r.FilePath, "*")); err != nil {
+			return replayed, fmt.Errorf("failed to replay deletion at line %d: %v", r.LineNumber, err)
+		}
+		if err := os.RemoveAll(filepath.Join(repoPath, r.FilePath)); err != nil {
+			return replayed, fmt.Errorf("failed to replay deletion at line %d: %v", r.LineNumber, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func treeAt(repo *git.Repository, hash plumbing.Hash) (*object.Tree, error) {
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load commit %s: %v", hash, err)
+	}
+	return commit.Tree()
+}
+
+// RetryPolicy describes how transient git/network failures are retried.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Jitter         float64 // fraction of the delay added or removed at random, 0..1
+}
+
+// withRetry calls fn until it succeeds, fails permanently or runs out of attempts.
+func withRetry(policy RetryPolicy, what string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !isTransientGitError(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("giving up on %s after %d attempts: %v", what, attempt, err)
+		}
+
+		delay := retryDelay(policy, attempt)
+		log.Printf("Transient failure on %s, attempt %d/%d, retrying in %s: %v", what, attempt, policy.MaxAttempts, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// isTransientGitError separates network, server and lock failures (worth retrying)
+// from authentication, missing repository and history conflicts (never retried).
+func isTransientGitError(err error) bool {
+	switch {
+	case err == git.NoErrAlreadyUpToDate,
+		errors.Is(err, git.ErrNonFastForwardUpdate),
+		errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrRepositoryNotFound),
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	msg := err.Error()
+	for _, pattern := range []string{"status code: 5", "connection reset", "timeout", "unexpected EOF", "lock"} {
+		if strings.Contains(msg, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay is exponential backoff capped at MaxBackoff, with +/- Jitter applied.
+func retryDelay(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.InitialBackoff << uint(attempt-1)
+	if delay <= 0 || (policy.MaxBackoff > 0 && delay > policy.MaxBackoff) {
+		delay = policy.MaxBackoff
+	}
+	if policy.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * policy.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// rollback resets the branch, index and worktree to the pre-run commit and marks every
+// row that had been applied as rolled back. It returns the local commits it discarded.
+func rollback(repo *git.Repository, worktree *git.Worktree, base plumbing.Hash, report *ExecutionReport, reason string) error {
+	head, err := repo.Head()
+	if err == nil && head.Hash() != base {
+		commits, logErr := repo.Log(&git.LogOptions{From: head.Hash()})
+		if logErr == nil {
+			commits.ForEach(func(c *object.Commit) error {
+				if c.Hash == base {
+					return storer.ErrStop
+				}
+				report.RolledBack = append(report.RolledBack, fmt.Sprintf("%s %s", c.Hash.String()[:7], strings.SplitN(c.Message, "\n", 2)[0]))
+				return nil
+			})
+		}
+	}
+
+	if err := worktree.Reset(&git.ResetOptions{Commit: base, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to reset to %s: %v", base, err)
+	}
+
+	for i := range report.Results {
+		if report.Results[i].Status == "success" {
+			report.Results[i].Status = "rolled_back"
+			report.Results[i].Error = "rolled back: " + reason
+			report.Results[i].CommitSHA = ""
+		}
+	}
+	for _, commit := range report.RolledBack {
+		log.Printf("Rolled back: %s", commit)
+	}
+	log.Printf("Atomic run rolled back to %s: %s", base, reason)
+	return nil
+}
+
+// OperationResult records the outcome of a single scenario line for the execution report.
+type OperationResult struct {
+	LineNumber    int       `json:"line"`
+	FilePath      string    `json:"path"`
+	OperationType string    `json:"operation"`
+	CommitMessage string    `json:"message"`
+	Status        string    `json:"status"` // "success", "failed", "skipped" or "rolled_back"
+	Error         string    `json:"error,omitempty"`
+	CommitSHA     string    `json:"commit_sha,omitempty"`
+	FilesTouched  []string  `json:"files_touched,omitempty"`
+	StartedAt     time.Time `json:"started_at"`
+	DurationMs    int64     `json:"duration_ms"`
+	Signature     string    `json:"signature,omitempty"` // with --sign: "good", "bad", "unverifiable" or "unsigned"
+	Signer        string    `json:"signer,omitempty"`
+}
+
+// ExecutionReport is the machine-readable summary of a scenario run.
+type ExecutionReport struct {
+	Executor   string            `json:"executor"`
+	Repository string            `json:"repository"`
+	Scenario   string            `json:"scenario"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Total      int               `json:"total"`
+	Succeeded  int               `json:"succeeded"`
+	Failed     int               `json:"failed"`
+	Skipped    int               `json:"skipped"`
+	Atomic     bool              `json:"atomic"`
+	RunID      string            `json:"run_id"`
+	Signing    string            `json:"signing,omitempty"`     // --sign format
+	RolledBack []string          `json:"rolled_back,omitempty"` // local commits discarded by an atomic rollback
+	Results    []OperationResult `json:"results"`
+}
+
+func skipResult(result OperationResult, reason string) OperationResult {
+	result.Status = "skipped"
+	result.Error = reason
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result
+}
+
+func failResult(result OperationResult, err error) OperationResult {
+	result.Status = "failed"
+	result.Error = err.Error()
+	result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+	return result
+}
+
+// setBatchCommit attaches the single deletion commit to every row that went into it.
+func setBatchCommit(report *ExecutionReport, sha string) {
+	for i := range report.Results {
+		if report.Results[i].Status == "success" {
+			report.Results[i].CommitSHA = sha
+		}
+	}
+}
+
+// notesRef holds the provenance notes of every executor.
+const notesRef = plumbing.ReferenceName("refs/notes/scenario")
+
+// newRunID names a run after its start time, with a random suffix for runs started in
+// the same second.
+func newRunID() string {
+	return fmt.Sprintf("%s-%04x", time.Now().UTC().Format("20060102T150405Z"), rand.Intn(0x10000))
+}
+
+// provenanceLines are the trailers, or note lines, that link the commit to the scenario
+// lines it applies.
+func provenanceLines(scenarioFile string, lines []int, runID string) []string {
+	provenance := []string{"Scenario-File: " + filepath.ToSlash(scenarioFile)}
+	for _, line := range lines {
+		provenance = append(provenance, fmt.Sprintf("Scenario-Line: %d", line))
+	}
+	return append(provenance, "Run-ID: "+runID)
+}
+
+// writeProvenanceNotes attaches note to the pushed commit in refs/notes/scenario and
+// pushes the notes ref. go-git has no notes support, so the notes commit is built by
+// hand on top of the remote's notes; if another run pushed notes meanwhile, it is built
+// again on top of those.
+func writeProvenanceNotes(repo *git.Repository, auth *http.BasicAuth, report *ExecutionReport, note string, author *object.Signature, policy PushPolicy) error {
+	commits := map[string]bool{}
+	for _, r := range report.Results {
+		if r.Status == "success" && r.CommitSHA != "" {
+			commits[r.CommitSHA] = true
+		}
+	}
+	if len(commits) == 0 {
+		return nil
+	}
+
+	fetchSpec := config.RefSpec(fmt.Sprintf("+%s:%s", notesRef, notesRef))
+	pushSpec := config.RefSpec(fmt.Sprintf("%s:%s", notesRef, notesRef))
+	for attempt := 0; ; attempt++ {
+		err := withRetry(policy.Transient, "fetch notes", func() error {
+			err := repo.Fetch(&git.FetchOptions{RemoteName: "origin", Auth: auth, RefSpecs: []config.RefSpec{fetchSpec}})
+			if err == git.NoErrAlreadyUpToDate || errors.Is(err, git.NoMatchingRefSpecError{}) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %v", notesRef, err)
+		}
+
+		if err := commitNotes(repo, commits, note, author); err != nil {
+			return err
+		}
+
+		err = withRetry(policy.Transient, "push notes", func() error {
+			return repo.Push(&git.PushOptions{RemoteName: "origin", Auth: auth, RefSpecs: []config.RefSpec{pushSpec}})
+		})
+		if err == nil || err == git.NoErrAlreadyUpToDate {
+			log.Printf("Pushed provenance notes to %s", notesRef)
+			return nil
+		}
+		if attempt >= policy.Retries || !errors.Is(err, git.ErrNonFastForwardUpdate) {
+			return fmt.Errorf("failed to push %s: %v", notesRef, err)
+		}
+		log.Printf("Notes push rejected, adding the notes again on top of the remote's")
+	}
+}
+
+// commitNotes adds one note blob per commit to the notes tree and moves the notes ref to
+// a new commit with that tree. Like git notes, a note goes into the fanout subtree (ab/
+// for abcdef...) if the tree already has one, and under the full hash otherwise.
+func commitNotes(repo *git.Repository, commits map[string]bool, note string, author *object.Signature) error {
+	var treeHash plumbing.Hash
+	var parents []plumbing.Hash
+	if ref, err := repo.Reference(notesRef, true); err == nil {
+		parent, err := repo.CommitObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+		treeHash = parent.TreeHash
+		parents = []plumbing.Hash{parent.Hash}
+	}
+
+	blob := repo.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+	writer, err := blob.Writer()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write([]byte(note + "\n")); err != nil {
+		return err
+	}
+	writer.Close()
+	blobHash, err := repo.Storer.SetEncodedObject(blob)
+	if err != nil {
+		return err
+	}
+	for sha := range commits {
+		if treeHash, err = putNote(repo, treeHash, sha, blobHash); err != nil {
+			return err
+		}
+	}
+
+	commit := &object.Commit{
+		Author:       *author,
+		Committer:    *author,
+		Message:      "Notes added by scenario executor\n",
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	commitObject := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(commitObject); err != nil {
+		return err
+	}
+	commitHash, err := repo.Storer.SetEncodedObject(commitObject)
+	if err != nil {
+		return err
+	}
+	return repo.Storer.SetReference(plumbing.NewHashReference(notesRef, commitHash))
+}
+
+// putNote stores blob as the note named name (what is left of the commit hash below
+// this level) in the tree treeHash, a zero hash for an empty tree, and returns the hash
+// of the new tree. A note already there is replaced.
+func putNote(repo *git.Repository, treeHash plumbing.Hash, name string, blob plumbing.Hash) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	if !treeHash.IsZero() {
+		existing, err := repo.TreeObject(treeHash)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, existing.Entries...)
+	}
+
+	entry := object.TreeEntry{Name: name, Mode: filemode.Regular, Hash: blob}
+	found := false
+	for i, e := range tree.Entries {
+		switch {
+		case e.Name == name:
+			tree.Entries[i], found = entry, true
+		case e.Mode == filemode.Dir && len(name) > 2 && e.Name == name[:2]:
+			subtree, err := putNote(repo, e.Hash, name[2:], blob)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+			tree.Entries[i].Hash, found = subtree, true
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		tree.Entries = append(tree.Entries, entry)
+	}
+
+	// Git sorts tree entries by name, with directories compared as if they ended in a slash
+	sortKey := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return sortKey(tree.Entries[i]) < sortKey(tree.Entries[j]) })
+	treeObject := repo.Storer.NewEncodedObject()
+	if err := tree.Encode(treeObject); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return repo.Storer.SetEncodedObject(treeObject)
+}
+
+// readSigningKey loads the first key of an ASCII-armored OpenPGP key file and decrypts
+// it with passphrase if needed.
+func readSigningKey(path, passphrase string) (*openpgp.Entity, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entities, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	entity := entities[0]
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("%s holds no private key", path)
+	}
+	if entity.PrivateKey.Encrypted {
+		if passphrase == "" {
+			return nil, fmt.Errorf("%s is encrypted; pass --signing-passphrase", path)
+		}
+		if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %v", path, err)
+		}
+	}
+	return entity, nil
+}
+
+// verifySignatures checks the signature of the pushed commit against the signing key and
+// records the outcome on every row it contains.
+func verifySignatures(repo *git.Repository, report *ExecutionReport, key *openpgp.Entity) {
+	var publicKey bytes.Buffer
+	writer, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	if err == nil {
+		err = key.Serialize(writer)
+		writer.Close()
+	}
+
+	checked := map[string][2]string{}
+	for i := range report.Results {
+		r := &report.Results[i]
+		if r.Status != "success" || r.CommitSHA == "" {
+			continue
+		}
+		outcome, ok := checked[r.CommitSHA]
+		if !ok {
+			outcome = [2]string{"unverifiable", ""}
+			if commit, cerr := repo.CommitObject(plumbing.NewHash(r.CommitSHA)); cerr == nil && err == nil {
+				if commit.PGPSignature == "" {
+					outcome = [2]string{"unsigned", ""}
+				} else if signer, verr := commit.Verify(publicKey.String()); verr != nil {
+					outcome = [2]string{"bad", ""}
+				} else {
+					outcome = [2]string{"good", signer.PrimaryKey.KeyIdString()}
+					for name := range signer.Identities {
+						outcome[1] = name
+						break
+					}
+				}
+			}
+			checked[r.CommitSHA] = outcome
+			log.Printf("Commit %s signature: %s %s", r.CommitSHA, outcome[0], outcome[1])
+		}
+		r.Signature, r.Signer = outcome[0], outcome[1]
+	}
+}
+
+// markBatchFailed fails every staged row when the batch commit or push fails.
+func markBatchFailed(report *ExecutionReport, err error) {
+	for i := range report.Results {
+		if report.Results[i].Status == "success" {
+			report.Results[i].Status = "failed"
+			report.Results[i].Error = err.Error()
+		}
+	}
+}
+
+func writeReports(report *ExecutionReport, reportPath, junitPath string) {
+	report.FinishedAt = time.Now()
+	report.Succeeded, report.Failed, report.Skipped = 0, 0, 0
+	for _, r := range report.Results {
+		switch r.Status {
+		case "success":
+			report.Succeeded++
+		case "failed":
+			report.Failed++
+		default:
+			report.Skipped++
+		}
+	}
+
+	if reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(reportPath, data, 0644)
+		}
+		if err != nil {
+			log.Printf("Failed to write JSON report: %v", err)
+		}
+	}
+	if junitPath != "" {
+		if err := writeJUnitReport(junitPath, *report); err != nil {
+			log.Printf("Failed to write JUnit report: %v", err)
+		}
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitReport emits one test case per scenario line so CI can show runs as test results.
+func writeJUnitReport(path string, report ExecutionReport) error {
+	suite := junitTestSuite{
+		Name:      fmt.Sprintf("%s: %s", report.Executor, report.Scenario),
+		Tests:     report.Total,
+		Failures:  report.Failed,
+		Skipped:   report.Skipped,
+		Time:      fmt.Sprintf("%.3f", report.FinishedAt.Sub(report.StartedAt).Seconds()),
+		Timestamp: report.StartedAt.Format(time.RFC3339),
+	}
+
+	for _, r := range report.Results {
+		tc := junitTestCase{
+			Name:      fmt.Sprintf("line %d: %s %s", r.LineNumber, r.OperationType, r.FilePath),
+			ClassName: report.Scenario,
+			Time:      fmt.Sprintf("%.3f", float64(r.DurationMs)/1000),
+		}
+		if r.CommitSHA != "" {
+			tc.SystemOut = fmt.Sprintf("commit %s", r.CommitSHA)
+			if r.Signature != "" {
+				tc.SystemOut += fmt.Sprintf(", signature %s", r.Signature)
+			}
+		}
+		switch r.Status {
+		case "failed":
+			tc.Failure = &junitFailure{Message: r.Error, Body: r.Error}
+		case "skipped", "rolled_back":
+			tc.Skipped = &junitSkipped{Message: r.Error}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %v", err)
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), data...), 0644)
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Fault is one scripted failure. Op is "fetch", "push" or "any"; Action is an HTTP status
+// code (401, 403, 500, 503, ...), "timeout" or "reject". Remaining counts down with every
+// request the fault is applied to; a negative value never runs out.
+type Fault struct {
+	Op        string `json:"op"`
+	Action    string `json:"action"`
+	Remaining int    `json:"remaining"`
+}
+
+// RequestRecord is one request the server handled, as listed by /-/requests.
+type RequestRecord struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Op     string    `json:"op"`
+	User   string    `json:"user,omitempty"`
+	Status int       `json:"status"`
+	Fault  string    `json:"fault,omitempty"`
+}
+
+// multiFlag collects a repeatable string flag.
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ", ") }
+func (m *multiFlag) Set(v string) error { *m = append(*m, v); return nil }
+
+// fakeRemote serves the bare repositories under root through git http-backend, checking
+// Basic Auth and applying the scripted faults first.
+type fakeRemote struct {
+	root          string
+	backend       string
+	hooksDir      string // holds the pre-receive hook that declines rejected pushes
+	rejectMessage string
+	hang          time.Duration
+	tokens        map[string]string // username to token; "*" accepts any username
+
+	mu       sync.Mutex
+	faults   []*Fault
+	requests []RequestRecord
+}
+
+func main() {
+	var tokens, faults, initRepos multiFlag
+	root := flag.String("root", "", "Directory of bare repositories to serve; <root>/<name>.git is served as http://<listen>/<name>.git")
+	listen := flag.String("listen", "127.0.0.1:8418", "Address to listen on (port 0 picks a free port)")
+	flag.Var(&tokens, "token", "Accepted credentials as user:token, repeatable; user * accepts any username (default: no authentication)")
+	flag.Var(&faults, "fault", "Scripted failure as op:action[xN], repeatable, e.g. push:503x2, fetch:timeout, push:reject, any:401")
+	flag.Var(&initRepos, "init", "Create an empty bare repository with this name under --root if it does not exist, repeatable")
+	hang := flag.Duration("hang", 30*time.Second, "How long a timeout fault holds the request before dropping the connection")
+	rejectMessage := flag.String("reject-message", "push declined by the fake remote", "Message a rejected push reports")
+	flag.Parse()
+
+	if *root == "" {
+		log.Fatal("Flag --root is required.")
+	}
+
+	server := &fakeRemote{hang: *hang, rejectMessage: *rejectMessage, tokens: map[string]string{}}
+	var err error
+	if server.root, err = filepath.Abs(*root); err != nil {
+		log.Fatalf("Invalid --root: %v", err)
+	}
+	if err := os.MkdirAll(server.root, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", server.root, err)
+	}
+	for _, entry := range tokens {
+		user, token, ok := strings.Cut(entry, ":")
+		if !ok || user == "" || token == "" {
+			log.Fatalf("Invalid --token %q: want user:token", entry)
+		}
+		server.tokens[user] = token
+	}
+	for _, spec := range faults {
+		fault, err := parseFault(spec)
+		if err != nil {
+			log.Fatalf("Invalid --fault: %v", err)
+		}
+		server.faults = append(server.faults, fault)
+	}
+	for _, name := range initRepos {
+		if err := initBareRepository(filepath.Join(server.root, name)); err != nil {
+			log.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	output, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		log.Fatalf("Failed to locate git: %v", err)
+	}
+	server.backend = filepath.Join(strings.TrimSpace(string(output)), "git-http-backend")
+	if _, err := os.Stat(server.backend); err != nil {
+		log.Fatalf("git-http-backend not found: %v", err)
+	}
+	if server.hooksDir, err = writeRejectHook(); err != nil {
+		log.Fatalf("Failed to write pre-receive hook: %v", err)
+	}
+	defer os.RemoveAll(server.hooksDir)
+
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", *listen, err)
+	}
+	// The first line of output is the base URL, for scripts that start the server with port 0
+	fmt.Printf("http://%s/\n", listener.Addr())
+	log.Printf("Serving %s (%d token(s), %d fault(s))", server.root, len(server.tokens), len(server.faults))
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		os.RemoveAll(server.hooksDir)
+		os.Exit(0)
+	}()
+
+	if err := http.Serve(listener, server); err != nil {
+		log.Fatalf("Server stopped: %v", err)
+	}
+}
+
+// parseFault reads op:action[xN].
+func parseFault(spec string) (*Fault, error) {
+	op, action, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	if !ok {
+		return nil, fmt.Errorf("%q: want op:action[xN]", spec)
+	}
+	fault := &Fault{Op: op, Action: action, Remaining: -1}
+	if i := strings.LastIndex(action, "x"); i > 0 {
+		n, err := strconv.Atoi(action[i+1:])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q: invalid count %q", spec, action[i+1:])
+		}
+		fault.Action, fault.Remaining = action[:i], n
+	}
+
+	switch fault.Op {
+	case "fetch", "push", "any":
+	default:
+		return nil, fmt.Errorf("%q: op must be fetch, push or any", spec)
+	}
+	switch {
+	case fault.Action == "timeout":
+	case fault.Action == "reject":
+		if fault.Op != "push" {
+			return nil, fmt.Errorf("%q: only pushes can be rejected", spec)
+		}
+	default:
+		code, err := strconv.Atoi(fault.Action)
+		if err != nil || code < 400 || code > 599 {
+			return nil, fmt.Errorf("%q: action must be an HTTP error status, timeout or reject", spec)
+		}
+	}
+	return fault, nil
+}
+
+// take returns the first fault that applies to this request and counts it down. Status
+// and timeout faults apply to the ref discovery that starts every fetch, ls-remote and
+// push; reject applies to the push itself, so the client gets as far as sending its pack.
+func (s *fakeRemote) take(op string, discovery bool) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, fault := range s.faults {
+		if fault.Remaining == 0 || (fault.Op != "any" && fault.Op != op) {
+			continue
+		}
+		if (fault.Action == "reject") == discovery {
+			continue
+		}
+		if fault.Remaining > 0 {
+			fault.Remaining--
+		}
+		return fault
+	}
+	return nil
+}
+
+// statusRecorder remembers the status code written through it, for the request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *fakeRemote) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/-/") {
+		s.control(w, r)
+		return
+	}
+
+	record := RequestRecord{Time: time.Now(), Method: r.Method, Path: r.URL.Path, Op: "other"}
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		service = filepath.Base(r.URL.Path)
+	}
+	switch service {
+	case "git-upload-pack":
+		record.Op = "fetch"
+	case "git-receive-pack":
+		record.Op = "push"
+	}
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	defer func() {
+		record.Status = rec.status
+		s.mu.Lock()
+		s.requests = append(s.requests, record)
+		s.mu.Unlock()
+		log.Printf("%s %s %s user=%q status=%d %s", record.Method, r.URL.RequestURI(), record.Op, record.User, record.Status, record.Fault)
+	}()
+
+	if len(s.tokens) > 0 {
+		user, token, ok := r.BasicAuth()
+		record.User = user
+		want, known := s.tokens[user]
+		if !known {
+			want, known = s.tokens["*"]
+		}
+		if !ok || !known || token != want {
+			rec.Header().Set("WWW-Authenticate", `Basic realm="fake remote"`)
+			http.Error(rec, "authentication required", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	env := []string{
+		"GIT_PROJECT_ROOT=" + s.root,
+		"GIT_HTTP_EXPORT_ALL=1",
+		"REMOTE_USER=" + record.User,
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.receivepack",
+		"GIT_CONFIG_VALUE_0=true",
+	}
+
+	discovery := strings.HasSuffix(r.URL.Path, "/info/refs")
+	if fault := s.take(record.Op, discovery); fault != nil {
+		record.Fault = fault.Op + ":" + fault.Action
+		switch fault.Action {
+		case "timeout":
+			select {
+			case <-time.After(s.hang):
+			case <-r.Context().Done():
+			}
+			// Drop the connection without an answer, as a dead proxy would
+			if hj, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hj.Hijack(); err == nil {
+					conn.Close()
+					rec.status = 0
+					return
+				}
+			}
+			http.Error(rec, "timed out", http.StatusGatewayTimeout)
+			return
+		case "reject":
+			env[3] = "GIT_CONFIG_COUNT=2"
+			env = append(env,
+				"GIT_CONFIG_KEY_1=core.hooksPath",
+				"GIT_CONFIG_VALUE_1="+s.hooksDir,
+				"FAKE_REMOTE_REJECT_MESSAGE="+s.rejectMessage,
+			)
+		default:
+			code, _ := strconv.Atoi(fault.Action)
+			http.Error(rec, http.StatusText(code), code)
+			return
+		}
+	}
+
+	handler := &cgi.Handler{Path: s.backend, Env: env, InheritEnv: []string{"PATH", "HOME"}}
+	handler.ServeHTTP(rec, r)
+}
+
+// control serves the scripting endpoints:
+//
+//	GET    /-/faults    list the faults and how often each still applies
+//	POST   /-/faults    add faults, one op:action[xN] per line
+//	PUT    /-/faults    replace the faults
+//	DELETE /-/faults    remove every fault
+//	GET    /-/requests  list the requests handled so far
+func (s *fakeRemote) control(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/-/faults" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var added []*Fault
+		for _, line := range strings.Split(string(body), "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			fault, err := parseFault(line)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			added = append(added, fault)
+		}
+		s.mu.Lock()
+		if r.Method == http.MethodPut {
+			s.faults = nil
+		}
+		s.faults = append(s.faults, added...)
+		s.mu.Unlock()
+		s.writeJSON(w, s.snapshotFaults())
+	case r.URL.Path == "/-/faults" && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		s.faults = nil
+		s.mu.Unlock()
+		s.writeJSON(w, []*Fault{})
+	case r.URL.Path == "/-/faults":
+		s.writeJSON(w, s.snapshotFaults())
+	case r.URL.Path == "/-/requests":
+		s.mu.Lock()
+		requests := append([]RequestRecord{}, s.requests...)
+		s.mu.Unlock()
+		s.writeJSON(w, requests)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *fakeRemote) snapshotFaults() []Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	faults := []Fault{}
+	for _, fault := range s.faults {
+		faults = append(faults, *fault)
+	}
+	return faults
+}
+
+func (s *fakeRemote) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeRejectHook creates the hooks directory used for rejected pushes. Its pre-receive
+// hook prints the reject message and fails, so the client sees a real remote rejection.
+func writeRejectHook() (string, error) {
+	dir, err := os.MkdirTemp("", "fake-remote-hooks-")
+	if err != nil {
+		return "", err
+	}
+	hook := "#!/bin/sh\necho \"$FAKE_REMOTE_REJECT_MESSAGE\" >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "pre-receive"), []byte(hook), 0755); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// initBareRepository creates an empty bare repository whose default branch is main.
+func initBareRepository(dir string) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	for _, args := range [][]string{{"init", "--quiet", "--bare", dir}, {"-C", dir, "symbolic-ref", "HEAD", "refs/heads/main"}} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
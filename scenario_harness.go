@@ -0,0 +1,1120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Exit codes shared by all executors
+const (
+	exitSuccess        = 0 // every scenario line succeeded
+	exitPartialFailure = 1 // the run finished with failed lines
+	exitFatal          = 2 // the run could not start or could not be completed
+)
+
+// executors maps the executor names used by the cases to their source files, plus the
+// fake HTTP remote that cases with Server use.
+var executors = map[string]string{
+	"create-update": "scenario_executor_create-update.go",
+	"file-delete":   "scenario_executor_file_delete.go",
+	"folder-delete": "scenario_executor_folder_delete.go",
+	"fake-remote":   "scenario_fake_remote.go",
+}
+
+// harnessCase is one end-to-end run: a bare origin seeded with Seed, a clone of it, one
+// executor run against the clone, and what origin must look like afterwards.
+type harnessCase struct {
+	Name     string
+	Executor string
+	Seed     map[string]string // files of the initial commit on origin
+	Scenario string            // scenario CSV
+	Args     []string          // extra executor flags; {dir} is replaced with the case directory
+	Setup    func(env *caseEnv) error
+	Server   []string // when set, origin is served over HTTP by the fake remote with these extra flags
+
+	WantExit    int
+	WantCommits []string          // subjects of the commits the run adds to origin's first-parent history, oldest first; merges are listed as mergeSubject
+	WantFiles   map[string]string // the complete tree of origin's main afterwards
+	WantStatus  []string          // report status of each scenario row, in order
+	NoClone     bool              // the run must not leave a clone at the --repo path
+	WantSigned  bool              // every commit the run adds is signed, and the report verifies it as good
+	WantLinks   []string          // Scenario-Line values of each commit the run adds, oldest first, read from Provenance
+	Provenance  string            // where WantLinks are recorded: trailers or notes
+	Diverges    bool              // the clone keeps commits origin refused, so it may end ahead of origin
+	WantHead    string            // subject of the clone's HEAD afterwards, which must have nothing in progress and a clean worktree
+}
+
+// caseEnv is the directory layout of one case.
+type caseEnv struct {
+	Dir      string // case directory
+	Origin   string // bare repository used as origin
+	Clone    string // clone the executor runs in (--repo)
+	Scenario string
+	Report   string
+	Seed     string // commit origin starts from
+	Remote   string // origin URL the executor uses
+}
+
+// HarnessReport is the JSON report of a harness run.
+type HarnessReport struct {
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+	Total      int          `json:"total"`
+	Passed     int          `json:"passed"`
+	Failed     int          `json:"failed"`
+	Cases      []CaseResult `json:"cases"`
+}
+
+// CaseResult is the outcome of one case. Problems lists every assertion that did not hold.
+type CaseResult struct {
+	Name       string   `json:"name"`
+	Executor   string   `json:"executor"`
+	Status     string   `json:"status"` // "passed" or "failed"
+	ExitCode   int      `json:"exit_code"`
+	Commits    []string `json:"commits"`
+	Tree       string   `json:"tree,omitempty"`
+	Problems   []string `json:"problems,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// mergeSubject stands for a merge commit in CaseResult.Commits and WantCommits.
+const mergeSubject = "<merge>"
+
+var baseFiles = map[string]string{
+	"README.md":           "harness\n",
+	"docs/guide.md":       "guide\n",
+	"docs/api/index.md":   "api\n",
+	"src/main.txt":        "main\n",
+	"src/util/helper.txt": "helper\n",
+}
+
+// withFiles returns baseFiles with changes applied; an empty value removes the file.
+func withFiles(changes map[string]string) map[string]string {
+	files := map[string]string{}
+	for path, content := range baseFiles {
+		files[path] = content
+	}
+	for path, content := range changes {
+		if content == "" {
+			delete(files, path)
+		} else {
+			files[path] = content
+		}
+	}
+	return files
+}
+
+var cases = []harnessCase{
+	{
+		Name:     "create-update/success",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Scenario: "#scenario-format: 2\npath,op,message,content,author,target\n" +
+			"notes/a.txt,create,add a,A,,\n" +
+			"notes/deep/b.txt,create,add b,B,,\n" +
+			"src/main.txt,update,update main,MAIN,,\n" +
+			"notes/a.txt,update,same a,A,,\n" +
+			"docs,move,move docs,,,manual\n",
+		WantCommits: []string{"add a", "add b", "update main", "move docs"},
+		WantFiles: withFiles(map[string]string{
+			"notes/a.txt": "A", "notes/deep/b.txt": "B", "src/main.txt": "MAIN",
+			"docs/guide.md": "", "docs/api/index.md": "", "manual/guide.md": "guide\n", "manual/api/index.md": "api\n",
+		}),
+		WantStatus: []string{"success", "success", "success", "success", "success"},
+	},
+	{
+		Name:     "create-update/missing-file",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"missing.txt,update,update missing,X\n" +
+			"new.txt,create,add new,N\n",
+		WantExit:    exitPartialFailure,
+		WantCommits: []string{"add new"},
+		WantFiles:   withFiles(map[string]string{"new.txt": "N"}),
+		WantStatus:  []string{"failed", "success"},
+	},
+	{
+		Name:     "create-update/on-error-stop",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Args:     []string{"--on-error", "stop"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"one.txt,create,add one,1\n" +
+			"missing.txt,update,update missing,X\n" +
+			"two.txt,create,add two,2\n",
+		WantExit:    exitPartialFailure,
+		WantCommits: []string{"add one"},
+		WantFiles:   withFiles(map[string]string{"one.txt": "1"}),
+		WantStatus:  []string{"success", "failed", "skipped"},
+	},
+	{
+		Name:     "create-update/atomic-rollback",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Args:     []string{"--atomic"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"one.txt,create,add one,1\n" +
+			"missing.txt,update,update missing,X\n",
+		WantExit:   exitPartialFailure,
+		WantFiles:  baseFiles,
+		WantStatus: []string{"rolled_back", "failed"},
+	},
+	{
+		Name:     "create-update/remote-moved-on",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Setup:    func(env *caseEnv) error { return pushFromOtherClone(env, "other.txt", "O", "concurrent change") },
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"mine.txt,create,add mine,M\n",
+		WantCommits: []string{"concurrent change", "add mine"},
+		WantFiles:   withFiles(map[string]string{"other.txt": "O", "mine.txt": "M"}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "create-update/sync-merge",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Setup:    pushOnCommit("other.txt", "O", "concurrent change"),
+		Args:     []string{"--sync", "merge"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"mine.txt,create,add mine,M\n",
+		WantCommits: []string{"add mine", mergeSubject},
+		WantFiles:   withFiles(map[string]string{"other.txt": "O", "mine.txt": "M"}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "create-update/remote-conflict",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Setup:    pushOnCommit("README.md", "theirs", "concurrent change"),
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"README.md,update,update readme,mine\n",
+		WantExit:    exitPartialFailure,
+		WantCommits: []string{"concurrent change"},
+		WantFiles:   withFiles(map[string]string{"README.md": "theirs"}),
+		WantStatus:  []string{"failed"},
+		Diverges:    true,
+		WantHead:    "update readme",
+	},
+	{
+		Name:     "create-update/ephemeral",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Args:     []string{"--ephemeral"},
+		Setup:    func(env *caseEnv) error { return os.RemoveAll(env.Clone) },
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"eph.txt,create,add eph,E\n",
+		WantCommits: []string{"add eph"},
+		WantFiles:   withFiles(map[string]string{"eph.txt": "E"}),
+		WantStatus:  []string{"success"},
+		NoClone:     true,
+	},
+	{
+		Name:     "create-update/dirty-worktree",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Setup: func(env *caseEnv) error {
+			return os.WriteFile(filepath.Join(env.Clone, "README.md"), []byte("local edit\n"), 0644)
+		},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"new.txt,create,add new,N\n",
+		WantExit:  exitFatal,
+		WantFiles: baseFiles,
+	},
+	{
+		Name:     "create-update/wrong-token",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Server:   []string{},
+		Args:     []string{"--token", "wrong-token"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"new.txt,create,add new,N\n",
+		WantExit:  exitFatal,
+		WantFiles: baseFiles,
+	},
+	{
+		Name:     "create-update/push-503-retried",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Server:   []string{"--fault", "push:503x2"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"new.txt,create,add new,N\n",
+		WantCommits: []string{"add new"},
+		WantFiles:   withFiles(map[string]string{"new.txt": "N"}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "create-update/fetch-timeout-retried",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Server:   []string{"--fault", "fetch:timeoutx1", "--hang", "100ms"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"new.txt,create,add new,N\n",
+		WantCommits: []string{"add new"},
+		WantFiles:   withFiles(map[string]string{"new.txt": "N"}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "create-update/push-rejected",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Server:   []string{"--fault", "push:reject"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"new.txt,create,add new,N\n",
+		WantExit:   exitPartialFailure,
+		WantFiles:  baseFiles,
+		WantStatus: []string{"failed"},
+		Diverges:   true,
+	},
+	{
+		Name:     "create-update/ssh-signed",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Setup:    writeSSHKey,
+		Args:     []string{"--sign", "ssh", "--signing-key", "{dir}/signing-key"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"one.txt,create,add one,1\n" +
+			"two.txt,create,add two,2\n",
+		WantCommits: []string{"add one", "add two"},
+		WantFiles:   withFiles(map[string]string{"one.txt": "1", "two.txt": "2"}),
+		WantStatus:  []string{"success", "success"},
+		WantSigned:  true,
+	},
+	{
+		Name:     "create-update/trailers",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Args:     []string{"--provenance", "trailers", "--run-id", "harness-run"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"one.txt,create,add one,1\n" +
+			"two.txt,create,add two,2\n",
+		WantCommits: []string{"add one", "add two"},
+		WantFiles:   withFiles(map[string]string{"one.txt": "1", "two.txt": "2"}),
+		WantStatus:  []string{"success", "success"},
+		Provenance:  "trailers",
+		WantLinks:   []string{"3", "4"},
+	},
+	{
+		Name:     "create-update/trailers-multi-line",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Args:     []string{"--provenance", "trailers"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"\n" +
+			"x1.txt,create,add x1,\"first\nsecond\"\n" +
+			"x2.txt,create,add x2,2\n",
+		WantCommits: []string{"add x1", "add x2"},
+		WantFiles:   withFiles(map[string]string{"x1.txt": "first\nsecond", "x2.txt": "2"}),
+		WantStatus:  []string{"success", "success"},
+		Provenance:  "trailers",
+		WantLinks:   []string{"4", "6"},
+	},
+	{
+		Name:     "create-update/notes",
+		Executor: "create-update",
+		Seed:     baseFiles,
+		Server:   []string{},
+		Args:     []string{"--provenance", "notes"},
+		Scenario: "#scenario-format: 2\npath,op,message,content\n" +
+			"one.txt,create,add one,1\n" +
+			"README.md,update,update readme,R\n",
+		WantCommits: []string{"add one", "update readme"},
+		WantFiles:   withFiles(map[string]string{"one.txt": "1", "README.md": "R"}),
+		WantStatus:  []string{"success", "success"},
+		Provenance:  "notes",
+		WantLinks:   []string{"3", "4"},
+	},
+	{
+		Name:     "file-delete/success",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n" +
+			"src/util/helper.txt,delete,remove helper\n",
+		WantCommits: []string{"Deleted 2 file(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"README.md": "", "src/util/helper.txt": ""}),
+		WantStatus:  []string{"success", "success"},
+	},
+	{
+		Name:     "file-delete/missing-file",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"missing.txt,delete,remove missing\n" +
+			"README.md,delete,remove readme\n",
+		WantExit:    exitPartialFailure,
+		WantCommits: []string{"Deleted 1 file(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"README.md": ""}),
+		WantStatus:  []string{"failed", "success"},
+	},
+	{
+		Name:     "file-delete/locked",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Setup:    holdLock,
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantExit:  exitFatal,
+		WantFiles: baseFiles,
+	},
+	{
+		Name:     "file-delete/wrong-token",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Server:   []string{},
+		Args:     []string{"--token", "wrong-token"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantExit:  exitFatal,
+		WantFiles: baseFiles,
+	},
+	{
+		Name:     "file-delete/push-503-retried",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Server:   []string{"--fault", "push:503x2"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantCommits: []string{"Deleted 1 file(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"README.md": ""}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "file-delete/push-rejected",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Server:   []string{"--fault", "push:reject"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantExit:  exitFatal,
+		WantFiles: baseFiles,
+		Diverges:  true,
+	},
+	{
+		Name:     "file-delete/sync-merge",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Setup:    func(env *caseEnv) error { return pushFromOtherClone(env, "other.txt", "O", "concurrent change") },
+		Args:     []string{"--sync", "merge"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantCommits: []string{"Deleted 1 file(s) as per scenario", mergeSubject},
+		WantFiles:   withFiles(map[string]string{"other.txt": "O", "README.md": ""}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "file-delete/remote-conflict",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Setup:    func(env *caseEnv) error { return pushFromOtherClone(env, "README.md", "theirs", "concurrent change") },
+		Args:     []string{"--push-retries", "5"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantExit:    exitFatal,
+		WantCommits: []string{"concurrent change"},
+		WantFiles:   withFiles(map[string]string{"README.md": "theirs"}),
+		WantStatus:  []string{"failed"},
+		Diverges:    true,
+		WantHead:    "Deleted 1 file(s) as per scenario",
+	},
+	{
+		Name:     "file-delete/gpg-signed",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Setup:    writeOpenPGPKey,
+		Args:     []string{"--sign", "gpg", "--signing-key", "{dir}/signing-key.asc"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n",
+		WantCommits: []string{"Deleted 1 file(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"README.md": ""}),
+		WantStatus:  []string{"success"},
+		WantSigned:  true,
+	},
+	{
+		Name:     "file-delete/notes",
+		Executor: "file-delete",
+		Seed:     baseFiles,
+		Server:   []string{},
+		Args:     []string{"--provenance", "notes"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"README.md,delete,remove readme\n" +
+			"missing.txt,delete,remove missing\n" +
+			"src/util/helper.txt,delete,remove helper\n",
+		WantExit:    exitPartialFailure,
+		WantCommits: []string{"Deleted 2 file(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"README.md": "", "src/util/helper.txt": ""}),
+		WantStatus:  []string{"success", "failed", "success"},
+		Provenance:  "notes",
+		WantLinks:   []string{"3 5"},
+	},
+	{
+		Name:     "folder-delete/fetch-timeout-retried",
+		Executor: "folder-delete",
+		Seed:     baseFiles,
+		Server:   []string{"--fault", "fetch:timeoutx1", "--hang", "100ms"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"docs,delete,remove docs\n",
+		WantCommits: []string{"Deleted 1 folder(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"docs/guide.md": "", "docs/api/index.md": ""}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "folder-delete/success",
+		Executor: "folder-delete",
+		Seed:     baseFiles,
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"docs,delete,remove docs\n",
+		WantCommits: []string{"Deleted 1 folder(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"docs/guide.md": "", "docs/api/index.md": ""}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "folder-delete/missing-folder",
+		Executor: "folder-delete",
+		Seed:     baseFiles,
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"nowhere,delete,remove nowhere\n",
+		WantFiles:  baseFiles,
+		WantStatus: []string{"skipped"},
+	},
+	{
+		Name:     "folder-delete/trailers",
+		Executor: "folder-delete",
+		Seed:     baseFiles,
+		Args:     []string{"--provenance", "trailers"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"docs,delete,remove docs\n",
+		WantCommits: []string{"Deleted 1 folder(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"docs/guide.md": "", "docs/api/index.md": ""}),
+		WantStatus:  []string{"success"},
+		Provenance:  "trailers",
+		WantLinks:   []string{"3"},
+	},
+	{
+		Name:     "folder-delete/sync-merge",
+		Executor: "folder-delete",
+		Seed:     baseFiles,
+		Setup:    func(env *caseEnv) error { return pushFromOtherClone(env, "other.txt", "O", "concurrent change") },
+		Args:     []string{"--sync", "merge"},
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"docs,delete,remove docs\n",
+		WantCommits: []string{"Deleted 1 folder(s) as per scenario", mergeSubject},
+		WantFiles:   withFiles(map[string]string{"other.txt": "O", "docs/guide.md": "", "docs/api/index.md": ""}),
+		WantStatus:  []string{"success"},
+	},
+	{
+		Name:     "folder-delete/ephemeral",
+		Executor: "folder-delete",
+		Seed:     baseFiles,
+		Args:     []string{"--ephemeral"},
+		Setup:    func(env *caseEnv) error { return os.RemoveAll(env.Clone) },
+		Scenario: "#scenario-format: 2\npath,op,message\n" +
+			"src/util,delete,remove util\n",
+		WantCommits: []string{"Deleted 1 folder(s) as per scenario"},
+		WantFiles:   withFiles(map[string]string{"src/util/helper.txt": ""}),
+		WantStatus:  []string{"success"},
+		NoClone:     true,
+	},
+}
+
+func main() {
+	scriptsDir := flag.String("scripts", ".", "Directory containing the executor sources")
+	workDir := flag.String("workdir", "", "Directory for origins, clones and executor binaries (default: a temporary directory)")
+	keep := flag.Bool("keep", false, "Keep the work directory after the run for inspection")
+	run := flag.String("run", "", "Only run cases whose name matches this regular expression")
+	reportPath := flag.String("report", "", "Path to write the JSON harness report (optional)")
+	verbose := flag.Bool("v", false, "Print the executor output of every case")
+	flag.Parse()
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		log.Fatalf("Invalid --run pattern: %v", err)
+	}
+
+	if *workDir == "" {
+		if *workDir, err = os.MkdirTemp("", "scenario-harness-"); err != nil {
+			log.Fatalf("Failed to create work directory: %v", err)
+		}
+	} else if err := os.MkdirAll(*workDir, 0755); err != nil {
+		log.Fatalf("Failed to create work directory: %v", err)
+	}
+	if *workDir, err = filepath.Abs(*workDir); err != nil {
+		log.Fatalf("Invalid work directory: %v", err)
+	}
+
+	// The executors only see the harness's git configuration, never the user's
+	home := filepath.Join(*workDir, "home")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", home, err)
+	}
+	env := append(os.Environ(), "HOME="+home, "XDG_CONFIG_HOME="+home, "GIT_CONFIG_NOSYSTEM=1", "GIT_TERMINAL_PROMPT=0")
+
+	bins, err := buildScripts(*scriptsDir, filepath.Join(*workDir, "bin"), env)
+	if err != nil {
+		log.Fatalf("Failed to build executors: %v", err)
+	}
+
+	report := HarnessReport{StartedAt: time.Now()}
+	for _, c := range cases {
+		if !filter.MatchString(c.Name) {
+			continue
+		}
+		result := runCase(c, bins, filepath.Join(*workDir, "cases"), env, *verbose)
+		report.Cases = append(report.Cases, result)
+		report.Total++
+		if result.Status == "passed" {
+			report.Passed++
+			fmt.Printf("PASS %s (%dms)\n", c.Name, result.DurationMs)
+		} else {
+			report.Failed++
+			fmt.Printf("FAIL %s (%dms)\n", c.Name, result.DurationMs)
+			for _, problem := range result.Problems {
+				fmt.Printf("    %s\n", problem)
+			}
+		}
+	}
+	report.FinishedAt = time.Now()
+
+	fmt.Printf("%d case(s): %d passed, %d failed.\n", report.Total, report.Passed, report.Failed)
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportPath, data, 0644)
+		}
+		if err != nil {
+			log.Printf("Failed to write report: %v", err)
+		}
+	}
+
+	if *keep {
+		fmt.Printf("Work directory kept at %s\n", *workDir)
+	} else {
+		os.RemoveAll(*workDir)
+	}
+	if report.Failed > 0 {
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// buildScripts compiles every executor and the fake remote once, so that the cases run binaries instead of
+// paying for go run each time.
+func buildScripts(scriptsDir, binDir string, env []string) (map[string]string, error) {
+	bins := map[string]string{}
+	for name, source := range executors {
+		bin := filepath.Join(binDir, name)
+		cmd := exec.Command("go", "build", "-o", bin, source)
+		cmd.Dir = scriptsDir
+		cmd.Env = env
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("go build %s: %v: %s", source, err, strings.TrimSpace(string(output)))
+		}
+		bins[name] = bin
+	}
+	return bins, nil
+}
+
+// runCase sets up origin and clone, runs the executor and checks the outcome.
+func runCase(c harnessCase, bins map[string]string, casesDir string, env []string, verbose bool) (result CaseResult) {
+	start := time.Now()
+	result = CaseResult{Name: c.Name, Executor: c.Executor, Status: "passed"}
+	fail := func(format string, args ...interface{}) {
+		result.Status = "failed"
+		result.Problems = append(result.Problems, fmt.Sprintf(format, args...))
+	}
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	dir := filepath.Join(casesDir, strings.ReplaceAll(c.Name, "/", "_"))
+	os.RemoveAll(dir)
+
+	// A HOME per case, so credentials the create/update executor stores for one case's
+	// server are never offered to another's
+	home := filepath.Join(dir, "home")
+	if err := os.MkdirAll(home, 0755); err != nil {
+		fail("setup: %v", err)
+		return result
+	}
+	env = append(env[:len(env):len(env)], "HOME="+home, "XDG_CONFIG_HOME="+home)
+	ce, err := prepareCase(dir, c, env)
+	if err != nil {
+		fail("setup: %v", err)
+		return result
+	}
+	if c.Server != nil {
+		stop, err := serveOrigin(ce, bins["fake-remote"], c.Server, env)
+		if err != nil {
+			fail("setup: %v", err)
+			return result
+		}
+		defer stop()
+	}
+	if c.Setup != nil {
+		if err := c.Setup(ce); err != nil {
+			fail("setup: %v", err)
+			return result
+		}
+	}
+
+	args := []string{
+		"--repo", ce.Clone,
+		"--remote", ce.Remote,
+		"--scenario", ce.Scenario,
+		"--username", "harness",
+		"--token", "harness-token",
+		"--report", ce.Report,
+		"--push-backoff", "10ms",
+		"--retry-backoff", "10ms",
+	}
+	if c.Executor == "create-update" {
+		args = append(args, "--log", filepath.Join(ce.Dir, "execution.log"), "--ops-per-second", "0")
+	}
+	for _, arg := range c.Args {
+		args = append(args, strings.ReplaceAll(arg, "{dir}", ce.Dir))
+	}
+
+	cmd := exec.Command(bins[c.Executor], args...)
+	cmd.Dir = ce.Dir
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	} else if err != nil {
+		fail("failed to run executor: %v", err)
+		return result
+	}
+	if verbose {
+		fmt.Printf("--- %s\n%s", c.Name, output)
+	}
+
+	if result.ExitCode != c.WantExit {
+		fail("exit code %d, want %d", result.ExitCode, c.WantExit)
+	}
+
+	// Commits the run added to origin. The subject of a merge names the remote, so merges
+	// are only counted.
+	subjects, err := git(ce.Origin, env, "log", "--reverse", "--first-parent", "--format=%P%x00%s", ce.Seed+"..main")
+	if err != nil {
+		fail("%v", err)
+		return result
+	}
+	merges := map[string]bool{}
+	if subjects != "" {
+		for _, line := range strings.Split(subjects, "\n") {
+			parents, subject, _ := strings.Cut(line, "\x00")
+			if strings.Contains(parents, " ") {
+				subject = mergeSubject
+			}
+			result.Commits = append(result.Commits, subject)
+		}
+	}
+	if hashes, err := git(ce.Origin, env, "rev-list", "--merges", ce.Seed+"..main"); err == nil {
+		for _, sha := range strings.Fields(hashes) {
+			merges[sha] = true
+		}
+	}
+	firstParent := map[string]bool{}
+	if hashes, err := git(ce.Origin, env, "rev-list", "--first-parent", ce.Seed+"..main"); err == nil {
+		for _, sha := range strings.Fields(hashes) {
+			firstParent[sha] = true
+		}
+	}
+	if strings.Join(result.Commits, "\n") != strings.Join(c.WantCommits, "\n") {
+		fail("origin commits %q, want %q", result.Commits, c.WantCommits)
+	}
+
+	// The complete tree of origin
+	if result.Tree, err = git(ce.Origin, env, "rev-parse", "main^{tree}"); err != nil {
+		fail("%v", err)
+	}
+	files, err := treeFiles(ce.Origin, env)
+	if err != nil {
+		fail("%v", err)
+	}
+	for _, path := range sortedKeys(c.WantFiles) {
+		content, ok := files[path]
+		if !ok {
+			fail("origin is missing %s", path)
+		} else if content != c.WantFiles[path] {
+			fail("origin has %s = %q, want %q", path, content, c.WantFiles[path])
+		}
+	}
+	for _, path := range sortedKeys(files) {
+		if _, ok := c.WantFiles[path]; !ok {
+			fail("origin has unexpected file %s", path)
+		}
+	}
+
+	// The clone must end where origin is, with nothing left behind
+	if c.NoClone {
+		if _, err := os.Stat(ce.Clone); err == nil {
+			fail("--repo path %s exists after the run", ce.Clone)
+		}
+	} else {
+		local, err := git(ce.Clone, env, "rev-parse", "HEAD")
+		remote, err2 := git(ce.Origin, env, "rev-parse", "main")
+		if err != nil || err2 != nil {
+			fail("failed to compare clone and origin: %v %v", err, err2)
+		} else if local != remote && !c.Diverges {
+			fail("clone is at %s, origin at %s", local[:7], remote[:7])
+		}
+		if data, err := os.ReadFile(filepath.Join(ce.Clone, ".git", "scenario-executor.lock")); err == nil && !bytes.Contains(data, []byte(`"executor":"harness"`)) {
+			fail("repository lock left behind: %s", data)
+		}
+	}
+	if c.WantHead != "" {
+		if subject, err := git(ce.Clone, env, "log", "-1", "--format=%s"); err != nil || subject != c.WantHead {
+			fail("clone HEAD is %q, want %q (%v)", subject, c.WantHead, err)
+		}
+		if status, err := git(ce.Clone, env, "status", "--porcelain"); err != nil || status != "" {
+			fail("clone worktree is not clean: %q (%v)", status, err)
+		}
+		for _, state := range []string{"MERGE_HEAD", "rebase-merge", "rebase-apply"} {
+			if _, err := os.Stat(filepath.Join(ce.Clone, ".git", state)); err == nil {
+				fail("clone has a %s in progress", state)
+			}
+		}
+	}
+
+	if c.WantSigned {
+		added, err := git(ce.Origin, env, "rev-list", ce.Seed+"..main")
+		if err != nil {
+			fail("%v", err)
+		}
+		for _, sha := range strings.Fields(added) {
+			raw, err := git(ce.Origin, env, "cat-file", "commit", sha)
+			if err != nil || !strings.Contains(raw, "\ngpgsig ") {
+				fail("origin commit %s is not signed", sha[:7])
+			}
+		}
+	}
+
+	if c.WantLinks != nil {
+		added, err := git(ce.Origin, env, "rev-list", "--reverse", ce.Seed+"..main")
+		if err != nil {
+			fail("%v", err)
+		}
+		var links []string
+		for _, sha := range strings.Fields(added) {
+			provenance, err := git(ce.Origin, env, "log", "-1", "--format=%B", sha)
+			if c.Provenance == "notes" {
+				provenance, err = git(ce.Origin, env, "notes", "--ref=scenario", "show", sha)
+			}
+			if err != nil {
+				fail("commit %s has no provenance %s: %v", sha[:7], c.Provenance, err)
+				continue
+			}
+			if !strings.Contains(provenance, "Scenario-File: "+filepath.ToSlash(ce.Scenario)+"\n") || !strings.Contains(provenance, "\nRun-ID: ") {
+				fail("commit %s provenance lacks Scenario-File or Run-ID:\n%s", sha[:7], indent(provenance))
+			}
+			var lines []string
+			for _, line := range strings.Split(provenance, "\n") {
+				if value, ok := strings.CutPrefix(line, "Scenario-Line: "); ok {
+					lines = append(lines, value)
+				}
+			}
+			links = append(links, strings.Join(lines, " "))
+		}
+		if strings.Join(links, ",") != strings.Join(c.WantLinks, ",") {
+			fail("scenario lines of the commits %v, want %v", links, c.WantLinks)
+		}
+	}
+
+	// Row outcomes from the executor's report
+	if c.WantStatus != nil {
+		var report struct {
+			Results []struct {
+				Status    string `json:"status"`
+				CommitSHA string `json:"commit_sha"`
+				Signature string `json:"signature"`
+			} `json:"results"`
+		}
+		data, err := os.ReadFile(ce.Report)
+		if err == nil {
+			err = json.Unmarshal(data, &report)
+		}
+		if err != nil {
+			fail("failed to read executor report: %v", err)
+		} else {
+			var got []string
+			for _, r := range report.Results {
+				got = append(got, r.Status)
+			}
+			if strings.Join(got, ",") != strings.Join(c.WantStatus, ",") {
+				fail("row statuses %v, want %v", got, c.WantStatus)
+			}
+			for i, r := range report.Results {
+				if c.WantSigned && r.CommitSHA != "" && r.Signature != "good" {
+					fail("row %d signature %q, want good", i+1, r.Signature)
+				}
+				// A pushed row names its own commit on origin, never a merge
+				if r.Status == "success" && r.CommitSHA != "" && !c.Diverges && (!firstParent[r.CommitSHA] || merges[r.CommitSHA]) {
+					fail("row %d commit_sha %s is not a scenario commit on origin's first-parent history", i+1, r.CommitSHA[:7])
+				}
+			}
+		}
+	}
+
+	if result.Status == "failed" && !verbose {
+		result.Problems = append(result.Problems, "executor output:\n"+indent(string(output)))
+	}
+	return result
+}
+
+// prepareCase creates a bare origin whose main branch holds c.Seed, clones it and writes
+// the scenario.
+func prepareCase(dir string, c harnessCase, env []string) (*caseEnv, error) {
+	ce := &caseEnv{
+		Dir:      dir,
+		Origin:   filepath.Join(dir, "origin.git"),
+		Clone:    filepath.Join(dir, "clone"),
+		Scenario: filepath.Join(dir, "scenario.csv"),
+		Report:   filepath.Join(dir, "report.json"),
+	}
+	ce.Remote = ce.Origin
+	seedDir := filepath.Join(dir, "seed")
+	for _, d := range []string{ce.Origin, seedDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := git(ce.Origin, env, "init", "--quiet", "--bare"); err != nil {
+		return nil, err
+	}
+	if _, err := git(ce.Origin, env, "symbolic-ref", "HEAD", "refs/heads/main"); err != nil {
+		return nil, err
+	}
+	if _, err := git(seedDir, env, "init", "--quiet"); err != nil {
+		return nil, err
+	}
+	if _, err := git(seedDir, env, "checkout", "--quiet", "-b", "main"); err != nil {
+		return nil, err
+	}
+	for path, content := range c.Seed {
+		full := filepath.Join(seedDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := git(seedDir, env, "add", "-A"); err != nil {
+		return nil, err
+	}
+	if _, err := git(seedDir, env, "commit", "--quiet", "-m", "seed"); err != nil {
+		return nil, err
+	}
+	if _, err := git(seedDir, env, "push", "--quiet", ce.Origin, "main"); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if ce.Seed, err = git(ce.Origin, env, "rev-parse", "main"); err != nil {
+		return nil, err
+	}
+	if _, err := git(dir, env, "clone", "--quiet", ce.Origin, ce.Clone); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(ce.Scenario, []byte(c.Scenario), 0644); err != nil {
+		return nil, err
+	}
+	return ce, nil
+}
+
+// serveOrigin starts the fake remote for the case directory, with the harness token and
+// the case's faults, and points the clone at it. The returned function stops the server.
+func serveOrigin(ce *caseEnv, bin string, flags []string, env []string) (func(), error) {
+	args := append([]string{"--root", ce.Dir, "--listen", "127.0.0.1:0", "--token", "*:harness-token"}, flags...)
+	cmd := exec.Command(bin, args...)
+	cmd.Env = env
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	logFile, err := os.Create(filepath.Join(ce.Dir, "fake-remote.log"))
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	stop := func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+		logFile.Close()
+	}
+
+	// The first line the server prints is its base URL
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("fake remote did not start: %v", err)
+	}
+	ce.Remote = strings.TrimSpace(line) + filepath.Base(ce.Origin)
+	if _, err := git(ce.Clone, env, "remote", "set-url", "origin", ce.Remote); err != nil {
+		stop()
+		return nil, err
+	}
+	return stop, nil
+}
+
+// pushFromOtherClone adds a commit to origin after the case's clone was made, so the run
+// has to integrate it.
+func pushFromOtherClone(env *caseEnv, path, content, message string) error {
+	gitEnv := append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1")
+	other := filepath.Join(env.Dir, "other")
+	if _, err := git(env.Dir, gitEnv, "clone", "--quiet", env.Origin, other); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(other, path), []byte(content), 0644); err != nil {
+		return err
+	}
+	for _, args := range [][]string{{"add", path}, {"commit", "--quiet", "-m", message}, {"push", "--quiet", "origin", "main"}} {
+		if _, err := git(other, gitEnv, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushOnCommit makes another clone push a commit of path right after the executor's first
+// commit in the clone. The create/update executor pulls before every row, so this is how
+// its push gets rejected.
+func pushOnCommit(path, content, message string) func(env *caseEnv) error {
+	return func(env *caseEnv) error {
+		other := filepath.Join(env.Dir, "other")
+		if _, err := git(env.Dir, os.Environ(), "clone", "--quiet", env.Origin, other); err != nil {
+			return err
+		}
+		hook := fmt.Sprintf(`#!/bin/sh
+[ -e %[1]q/pushed ] && exit 0
+touch %[1]q/pushed
+unset GIT_DIR GIT_INDEX_FILE GIT_WORK_TREE
+cd %[1]q/other && printf %%s %[2]q > %[3]q && git add %[3]q &&
+	git -c user.name=harness -c user.email=harness@example.com commit --quiet -m %[4]q &&
+	git push --quiet origin main
+`, env.Dir, content, path, message)
+		return os.WriteFile(filepath.Join(env.Clone, ".git", "hooks", "post-commit"), []byte(hook), 0755)
+	}
+}
+
+// holdLock writes a repository lock owned by the harness itself, which is alive, so the
+// executor must refuse to run.
+func holdLock(env *caseEnv) error {
+	host, _ := os.Hostname()
+	lock, err := json.Marshal(map[string]interface{}{
+		"pid":        os.Getpid(),
+		"host":       host,
+		"executor":   "harness",
+		"scenario":   "held by the harness",
+		"started_at": time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(env.Clone, ".git", "scenario-executor.lock"), lock, 0644)
+}
+
+// git runs a git command in dir with a fixed identity and returns its trimmed output.
+func git(dir string, env []string, args ...string) (string, error) {
+	args = append([]string{"-c", "user.name=harness", "-c", "user.email=harness@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args[4:], " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// writeSSHKey creates an unencrypted SSH signing key at {dir}/signing-key.
+func writeSSHKey(env *caseEnv) error {
+	output, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "harness", "-f", filepath.Join(env.Dir, "signing-key")).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ssh-keygen: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeOpenPGPKey creates an unencrypted ASCII-armored OpenPGP key at {dir}/signing-key.asc.
+func writeOpenPGPKey(env *caseEnv) error {
+	entity, err := openpgp.NewEntity("Harness", "", "harness@example.com", nil)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(env.Dir, "signing-key.asc"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer, err := armor.Encode(file, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return err
+	}
+	if err := entity.SerializePrivate(writer, nil); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// treeFiles returns every file on origin's main with its content.
+func treeFiles(origin string, env []string) (map[string]string, error) {
+	list, err := git(origin, env, "ls-tree", "-r", "--name-only", "main")
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	if list == "" {
+		return files, nil
+	}
+	for _, path := range strings.Split(list, "\n") {
+		cmd := exec.Command("git", "cat-file", "blob", "main:"+path)
+		cmd.Dir = origin
+		cmd.Env = env
+		content, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file blob main:%s: %v", path, err)
+		}
+		files[path] = string(content)
+	}
+	return files, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "      " + line
+	}
+	return strings.Join(lines, "\n")
+}
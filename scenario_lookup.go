@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// notesRef holds the provenance notes of every executor.
+const notesRef = "refs/notes/scenario"
+
+// Provenance is what a commit records about the scenario rows that produced it, from
+// its trailers or from its note in refs/notes/scenario.
+type Provenance struct {
+	Commit   string          `json:"commit"`
+	Subject  string          `json:"subject"`
+	Source   string          `json:"source,omitempty"` // trailers or notes
+	Scenario string          `json:"scenario_file,omitempty"`
+	RunID    string          `json:"run_id,omitempty"`
+	Rows     []ProvenanceRow `json:"rows,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// ProvenanceRow is one scenario line a commit applies.
+type ProvenanceRow struct {
+	Line   int    `json:"line"`
+	Text   string `json:"text,omitempty"`   // the line as it is in the scenario file now
+	Origin string `json:"origin,omitempty"` // template file:line, for rows expanded from a YAML/JSON scenario
+}
+
+func main() {
+	repoPath := flag.String("repo", "", "Path to the local Git repository")
+	scenarioDir := flag.String("scenario-dir", ".", "Directory that relative Scenario-File paths are resolved against")
+	fetch := flag.Bool("fetch", false, "Fetch origin and its provenance notes before looking up")
+	username := flag.String("username", "", "GitHub username (only needed with --fetch)")
+	token := flag.String("token", "", "GitHub personal access token (only needed with --fetch)")
+	jsonOutput := flag.Bool("json", false, "Print the result as JSON")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s --repo <path> [flags] <commit>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *repoPath == "" || flag.NArg() == 0 {
+		log.Fatal("Flag --repo and at least one commit are required.")
+	}
+
+	repo, err := git.PlainOpen(*repoPath)
+	if err != nil {
+		log.Fatalf("Failed to open repository at %s: %v", *repoPath, err)
+	}
+
+	if *fetch {
+		fetchOptions := &git.FetchOptions{
+			RemoteName: "origin",
+			RefSpecs: []config.RefSpec{
+				"+refs/heads/*:refs/remotes/origin/*",
+				config.RefSpec(fmt.Sprintf("+%s:%s", notesRef, notesRef)),
+			},
+		}
+		if *username != "" && *token != "" {
+			fetchOptions.Auth = &http.BasicAuth{Username: *username, Password: *token}
+		}
+		err = repo.Fetch(fetchOptions)
+		if errors.Is(err, git.NoMatchingRefSpecError{}) {
+			// origin has no notes yet
+			fetchOptions.RefSpecs = fetchOptions.RefSpecs[:1]
+			err = repo.Fetch(fetchOptions)
+		}
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			log.Fatalf("Failed to fetch origin: %v", err)
+		}
+	}
+
+	var results []Provenance
+	missing := 0
+	for _, rev := range flag.Args() {
+		p := lookup(repo, rev, *scenarioDir)
+		if p.Error != "" {
+			missing++
+		}
+		results = append(results, p)
+	}
+
+	if *jsonOutput {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode result: %v", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, p := range results {
+			printProvenance(p)
+		}
+	}
+
+	if missing > 0 {
+		os.Exit(1)
+	}
+}
+
+// lookup resolves rev and reads its provenance. Trailers win over a note, because they
+// cannot have been rewritten after the push.
+func lookup(repo *git.Repository, rev, scenarioDir string) Provenance {
+	p := Provenance{Commit: rev}
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		p.Error = fmt.Sprintf("failed to resolve %s: %v", rev, err)
+		return p
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		p.Error = fmt.Sprintf("failed to load commit %s: %v", hash, err)
+		return p
+	}
+	p.Commit = hash.String()
+	p.Subject = strings.SplitN(commit.Message, "\n", 2)[0]
+
+	fields := trailerBlock(commit.Message)
+	p.Source = "trailers"
+	if fields == nil {
+		note, err := readNote(repo, *hash)
+		if err != nil {
+			p.Source = ""
+			p.Error = err.Error()
+			return p
+		}
+		fields = parseFields(note)
+		p.Source = "notes"
+	}
+
+	var origins []string
+	for _, field := range fields {
+		switch field[0] {
+		case "Scenario-File":
+			p.Scenario = field[1]
+		case "Run-ID":
+			p.RunID = field[1]
+		case "Scenario-Origin":
+			origins = append(origins, field[1])
+		case "Scenario-Line":
+			line, err := strconv.Atoi(field[1])
+			if err != nil {
+				p.Error = fmt.Sprintf("invalid Scenario-Line %q", field[1])
+				return p
+			}
+			p.Rows = append(p.Rows, ProvenanceRow{Line: line})
+		}
+	}
+	if p.Scenario == "" || len(p.Rows) == 0 {
+		p.Error = fmt.Sprintf("%s has no Scenario-File and Scenario-Line", p.Source)
+		return p
+	}
+	// Scenario-Origin is only written for commits of a single row
+	if len(origins) == 1 && len(p.Rows) == 1 {
+		p.Rows[0].Origin = origins[0]
+	}
+
+	path := filepath.FromSlash(p.Scenario)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(scenarioDir, path)
+	}
+	lines, err := readLines(path)
+	if err != nil {
+		log.Printf("Cannot show the rows of %s: %v", p.Scenario, err)
+		return p
+	}
+	for i, row := range p.Rows {
+		if row.Line >= 1 && row.Line <= len(lines) {
+			p.Rows[i].Text = lines[row.Line-1]
+		}
+	}
+	return p
+}
+
+// trailerBlock returns the provenance trailers of a commit message: the key/value lines
+// of its last paragraph, if that paragraph has a Scenario-File trailer.
+func trailerBlock(message string) [][2]string {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+	fields := parseFields(paragraphs[len(paragraphs)-1])
+	for _, field := range fields {
+		if field[0] == "Scenario-File" {
+			return fields
+		}
+	}
+	return nil
+}
+
+// parseFields splits "Key: value" lines, skipping anything else.
+func parseFields(text string) [][2]string {
+	var fields [][2]string
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		fields = append(fields, [2]string{key, strings.TrimSpace(value)})
+	}
+	return fields
+}
+
+// readNote reads the note of commit from refs/notes/scenario. git notes stores a note
+// under the commit's hash, or under a fanout path such as ab/cdef... once the notes
+// tree grows, so every fanout depth is tried.
+func readNote(repo *git.Repository, commit plumbing.Hash) (string, error) {
+	ref, err := repo.Reference(plumbing.ReferenceName(notesRef), true)
+	if err != nil {
+		return "", fmt.Errorf("no trailers, and no %s in this repository (try --fetch)", notesRef)
+	}
+	notes, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return "", err
+	}
+	tree, err := notes.Tree()
+	if err != nil {
+		return "", err
+	}
+
+	sha := commit.String()
+	for depth := 0; depth < len(sha)/2; depth++ {
+		var parts []string
+		for i := 0; i < depth; i++ {
+			parts = append(parts, sha[2*i:2*i+2])
+		}
+		file, err := tree.File(strings.Join(append(parts, sha[2*depth:]), "/"))
+		if err == object.ErrFileNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return file.Contents()
+	}
+	return "", fmt.Errorf("no trailers, and no note in %s", notesRef)
+}
+
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	return lines, scanner.Err()
+}
+
+func printProvenance(p Provenance) {
+	if p.Subject == "" {
+		fmt.Printf("%s\n    %s\n", p.Commit, p.Error)
+		return
+	}
+	fmt.Printf("%s %s\n", p.Commit[:7], p.Subject)
+	if p.Error != "" {
+		fmt.Printf("    %s\n", p.Error)
+		return
+	}
+	fmt.Printf("    run %s (from %s)\n", p.RunID, p.Source)
+	for _, row := range p.Rows {
+		fmt.Printf("    %s:%d: %s\n", p.Scenario, row.Line, row.Text)
+		if row.Origin != "" {
+			fmt.Printf("        expanded from %s\n", row.Origin)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// currentFormatVersion is the scenario format this tool migrates to.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
+
+// scenarioColumns is the column order rows are kept in while migrating.
+var scenarioColumns = []string{"path", "op", "message", "content", "author", "target", "repo", "time"}
+
+// migrations upgrade rows from version N to N+1. Rows are in scenarioColumns order.
+var migrations = map[int]func(rows [][]string){
+	// Version 2 writes updates without content as empty files, so the version 1
+	// placeholder is spelled out.
+	1: func(rows [][]string) {
+		for _, row := range rows {
+			if row[1] == "update" && row[3] == "" {
+				row[3] = "test data"
+			}
+		}
+	},
+}
+
+func main() {
+	scenarioPath := flag.String("scenario", "", "Path to the scenario CSV to migrate")
+	outputFile := flag.String("output", "", "Path to write the migrated scenario (default: rewrite --scenario, keeping a .bak copy)")
+	flag.Parse()
+
+	if *scenarioPath == "" {
+		log.Fatal("Flag --scenario is required.")
+	}
+	if ext := strings.ToLower(filepath.Ext(*scenarioPath)); ext == ".yaml" || ext == ".yml" || ext == ".json" {
+		log.Fatalf("%s is a YAML/JSON scenario, which is always at format %d; use scenario_converter.go to change its format.", *scenarioPath, currentFormatVersion)
+	}
+	output := *outputFile
+	if output == "" {
+		output = *scenarioPath
+	}
+
+	version, rows, err := readScenario(*scenarioPath)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *scenarioPath, err)
+	}
+	if version == currentFormatVersion && output == *scenarioPath {
+		fmt.Printf("%s is already at format %d, nothing to do.\n", *scenarioPath, version)
+		return
+	}
+
+	for v := version; v < currentFormatVersion; v++ {
+		migrations[v](rows)
+	}
+	rebaseContentReferences(rows, filepath.Dir(*scenarioPath), filepath.Dir(output))
+
+	if output == *scenarioPath {
+		data, err := os.ReadFile(*scenarioPath)
+		if err != nil {
+			log.Fatalf("Failed to back up %s: %v", *scenarioPath, err)
+		}
+		if err := os.WriteFile(*scenarioPath+".bak", data, 0644); err != nil {
+			log.Fatalf("Failed to back up %s: %v", *scenarioPath, err)
+		}
+	}
+	if err := writeScenario(output, rows); err != nil {
+		log.Fatalf("Failed to write %s: %v", output, err)
+	}
+
+	fmt.Printf("%s migrated from format %d to %d: %d row(s) written to %s.\n", *scenarioPath, version, currentFormatVersion, len(rows), output)
+}
+
+// readScenario returns the format version and the rows in scenarioColumns order, with
+// fields trimmed the way the executor trims them.
+func readScenario(filename string) (int, [][]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	version := 1
+	var positions []int
+	headerChecked := false
+	var rows [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The parse error names its line
+			return 0, nil, fmt.Errorf("CSV parsing error: %v", err)
+		}
+		// A quoted field may span lines, so count from where the record starts
+		lineNumber, _ := reader.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		if !headerChecked {
+			if version == 1 {
+				v, isMarker, err := parseFormatMarker(record)
+				if err != nil {
+					return 0, nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				if isMarker {
+					version = v
+					continue
+				}
+			}
+			headerChecked = true
+			var isHeader bool
+			if positions, isHeader, err = parseHeader(record); err != nil {
+				return 0, nil, fmt.Errorf("invalid header at line %d: %v", lineNumber, err)
+			}
+			if isHeader {
+				continue
+			}
+		}
+		if positions != nil {
+			record = reorderRecord(record, positions)
+		}
+
+		if len(record) < 3 {
+			return 0, nil, fmt.Errorf("invalid row at line %d: expected at least 3 columns, got %d", lineNumber, len(record))
+		}
+		row := make([]string, len(scenarioColumns))
+		for i := range row {
+			if i < len(record) {
+				row[i] = strings.TrimSpace(record[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return version, rows, nil
+}
+
+// rebaseContentReferences keeps relative "@file:" references working when the migrated
+// scenario is written to another directory.
+func rebaseContentReferences(rows [][]string, fromDir, toDir string) {
+	if filepath.Clean(fromDir) == filepath.Clean(toDir) {
+		return
+	}
+	for _, row := range rows {
+		if !strings.HasPrefix(row[3], "@file:") {
+			continue
+		}
+		ref := strings.TrimPrefix(row[3], "@file:")
+		if filepath.IsAbs(ref) {
+			continue
+		}
+		if rel, err := filepath.Rel(toDir, filepath.Join(fromDir, ref)); err == nil {
+			row[3] = "@file:" + filepath.ToSlash(rel)
+		}
+	}
+}
+
+// writeScenario writes the current format: marker, header and rows. Columns after content
+// are only written when some row uses them.
+func writeScenario(filename string, rows [][]string) error {
+	columns := 4
+	for _, row := range rows {
+		for i := columns; i < len(row); i++ {
+			if row[i] != "" {
+				columns = i + 1
+			}
+		}
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{fmt.Sprintf("%s %d", formatMarker, currentFormatVersion)})
+	writer.Write(scenarioColumns[:columns])
+	for _, row := range rows {
+		writer.Write(row[:columns])
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// parseFormatMarker reports whether record is a "#scenario-format: N" line and returns N.
+func parseFormatMarker(record []string) (int, bool, error) {
+	if len(record) != 1 || !strings.HasPrefix(strings.TrimSpace(record[0]), formatMarker) {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), formatMarker)))
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid format marker %q", record[0])
+	}
+	if version > currentFormatVersion {
+		return version, true, fmt.Errorf("scenario format %d is newer than this tool supports (%d)", version, currentFormatVersion)
+	}
+	return version, true, nil
+}
+
+// columnAliases are alternative header spellings.
+var columnAliases = map[string]string{
+	"operation":   "op",
+	"file":        "path",
+	"commit":      "message",
+	"target_path": "target",
+	"repository":  "repo",
+}
+
+// parseHeader reports whether record is a header row (it names both "path" and "op") and
+// returns, for every entry of scenarioColumns, the index it appears at or -1. Unknown
+// column names are an error; columns starting with "x-" are dropped by the migration.
+func parseHeader(record []string) ([]int, bool, error) {
+	names := make([]string, len(record))
+	isHeader := map[string]bool{}
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		names[i] = name
+		isHeader[name] = true
+	}
+	if !isHeader["path"] || !isHeader["op"] {
+		return nil, false, nil
+	}
+
+	positions := make([]int, len(scenarioColumns))
+	for i := range positions {
+		positions[i] = -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		column := -1
+		for j, known := range scenarioColumns {
+			if name == known {
+				column = j
+			}
+		}
+		if column < 0 {
+			return nil, true, fmt.Errorf("unknown column %q in header (known: %s; prefix custom columns with x-)", record[i], strings.Join(scenarioColumns, ", "))
+		}
+		if positions[column] >= 0 {
+			return nil, true, fmt.Errorf("column %q appears more than once in header", name)
+		}
+		positions[column] = i
+	}
+	if positions[2] < 0 {
+		return nil, true, fmt.Errorf("header has no %q column", "message")
+	}
+	return positions, true, nil
+}
+
+// reorderRecord returns record in the scenarioColumns order described by positions.
+func reorderRecord(record []string, positions []int) []string {
+	var reordered []string
+	for column, index := range positions {
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		for len(reordered) < column {
+			reordered = append(reordered, "")
+		}
+		reordered = append(reordered, record[index])
+	}
+	return reordered
+}
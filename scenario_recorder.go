@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+func main() {
+	repoPath := flag.String("repo", "", "Path to the Git repository to record from")
+	commitRange := flag.String("range", "", "Commit range to record, e.g. v1.0..main (default: all history of HEAD)")
+	outputFile := flag.String("output", "scenario_recorded.csv", "Path of the scenario CSV to write")
+	contentDir := flag.String("content-dir", "", "Directory for content that cannot be stored inline (default: <output>_content)")
+	flag.Parse()
+
+	if *repoPath == "" {
+		log.Fatal("Flag --repo is required.")
+	}
+	if *contentDir == "" {
+		*contentDir = strings.TrimSuffix(*outputFile, filepath.Ext(*outputFile)) + "_content"
+	}
+
+	repo, err := git.PlainOpen(*repoPath)
+	if err != nil {
+		log.Fatalf("Failed to open repository at %s: %v", *repoPath, err)
+	}
+
+	commits, err := commitsToRecord(repo, *commitRange)
+	if err != nil {
+		log.Fatalf("Failed to list commits: %v", err)
+	}
+
+	file, err := os.Create(*outputFile)
+	if err != nil {
+		log.Fatalf("Failed to create CSV: %v", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{fmt.Sprintf("%s %d", formatMarker, currentFormatVersion)})
+	writer.Write([]string{"path", "op", "message", "content", "author", "target", "time"})
+
+	rows := 0
+	for _, c := range commits {
+		records, err := recordCommit(c, *outputFile, *contentDir)
+		if err != nil {
+			log.Fatalf("Failed to record commit %s: %v", c.Hash, err)
+		}
+		for _, record := range records {
+			writer.Write(record)
+		}
+		rows += len(records)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	fmt.Printf("%s created successfully: %d row(s) from %d commit(s).\n", *outputFile, rows, len(commits))
+}
+
+// commitsToRecord returns the first-parent history in the range, oldest first.
+func commitsToRecord(repo *git.Repository, commitRange string) ([]*object.Commit, error) {
+	var from *plumbing.Hash
+	to := "HEAD"
+	if commitRange != "" {
+		parts := strings.SplitN(commitRange, "..", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("range must look like <from>..<to>, got %q", commitRange)
+		}
+		hash, err := repo.ResolveRevision(plumbing.Revision(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %v", parts[0], err)
+		}
+		from = hash
+		if parts[1] != "" {
+			to = parts[1]
+		}
+	}
+
+	toHash, err := repo.ResolveRevision(plumbing.Revision(to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", to, err)
+	}
+
+	var commits []*object.Commit
+	c, err := repo.CommitObject(*toHash)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if from != nil && c.Hash == *from {
+			break
+		}
+		commits = append(commits, c)
+		if c.NumParents() == 0 {
+			if from != nil {
+				return nil, fmt.Errorf("%s is not an ancestor of %s", commitRange, to)
+			}
+			break
+		}
+		if c, err = c.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+	return commits, nil
+}
+
+// recordCommit turns the changes of one commit into scenario rows:
+// path, operation, message, content, author, target path, time.
+func recordCommit(c *object.Commit, outputFile, contentDir string) ([][]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), parentTree, tree, &object.DiffTreeOptions{DetectRenames: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the subject line: the executor passes messages through a single -m argument
+	message := strings.TrimSpace(strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0])
+	author := fmt.Sprintf("%s <%s>", c.Author.Name, c.Author.Email)
+	// Committer time, which follows first-parent order, so --replay-speed can space the rows
+	when := c.Committer.When.Format(time.RFC3339)
+	row := func(path, op, content, target string) []string {
+		return []string{path, op, message, content, author, target, when}
+	}
+
+	var records [][]string
+	for _, ch := range changes {
+		action, err := ch.Action()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case action == merkletrie.Modify && ch.From.Name != ch.To.Name: // rename detected
+			records = append(records, row(ch.From.Name, "move", "", ch.To.Name))
+			if ch.From.TreeEntry.Hash != ch.To.TreeEntry.Hash {
+				content, err := contentColumn(tree, ch.To.Name, outputFile, contentDir)
+				if err != nil {
+					return nil, err
+				}
+				records = append(records, row(ch.To.Name, "update", content, ""))
+			}
+		case ch.From.Name == "":
+			content := "" // a create without content makes an empty file
+			if !isEmptyBlob(ch.To.TreeEntry.Hash) {
+				if content, err = contentColumn(tree, ch.To.Name, outputFile, contentDir); err != nil {
+					return nil, err
+				}
+			}
+			records = append(records, row(ch.To.Name, "create", content, ""))
+		case ch.To.Name == "":
+			records = append(records, row(ch.From.Name, "delete", "", ""))
+		default:
+			content, err := contentColumn(tree, ch.To.Name, outputFile, contentDir)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, row(ch.To.Name, "update", content, ""))
+		}
+	}
+	return records, nil
+}
+
+// contentColumn returns the file content inline when the executor would read it back
+// unchanged, otherwise it stores the blob under contentDir and returns "@file:<path>".
+func contentColumn(tree *object.Tree, name, outputFile, contentDir string) (string, error) {
+	file, err := tree.File(name)
+	if err != nil {
+		return "", err
+	}
+
+	binary, err := file.IsBinary()
+	if err != nil {
+		return "", err
+	}
+	if !binary {
+		content, err := file.Contents()
+		if err != nil {
+			return "", err
+		}
+		// The executor trims fields
+		if content == strings.TrimSpace(content) && !strings.HasPrefix(content, "@file:") {
+			return content, nil
+		}
+	}
+
+	if err := os.MkdirAll(contentDir, 0755); err != nil {
+		return "", err
+	}
+	blobPath := filepath.Join(contentDir, file.Hash.String())
+	if _, err := os.Stat(blobPath); os.IsNotExist(err) {
+		reader, err := file.Reader()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+		out, err := os.Create(blobPath)
+		if err != nil {
+			return "", err
+		}
+		defer out.Close()
+		if _, err := out.ReadFrom(reader); err != nil {
+			return "", err
+		}
+	}
+
+	// References are resolved relative to the scenario file
+	rel, err := filepath.Rel(filepath.Dir(outputFile), blobPath)
+	if err != nil {
+		rel = blobPath
+	}
+	return "@file:" + filepath.ToSlash(rel), nil
+}
+
+// isEmptyBlob reports whether hash is git's well-known empty blob.
+func isEmptyBlob(hash plumbing.Hash) bool {
+	return hash.String() == "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"
+}
+
+// currentFormatVersion is the scenario format this tool writes.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// executionReport is the subset of an executor's JSON report needed to find its commits.
+type executionReport struct {
+	Scenario string `json:"scenario"`
+	Results  []struct {
+		Status     string `json:"status"`
+		CommitSHA  string `json:"commit_sha"`
+		Repository string `json:"repository"`
+	} `json:"results"`
+}
+
+// repositoryFilter selects the results of a multi-repository run that belong to the
+// reverted repository. Results without a repository, and those the executor ran in its
+// --repo, belong to --repo, so they are selected only when no --repo-name is given.
+type repositoryFilter struct {
+	Path string
+	Name string
+}
+
+func (f repositoryFilter) matches(repo string) bool {
+	repo = strings.TrimSpace(repo)
+	if repo == "" {
+		return f.Name == ""
+	}
+	if repo == f.Name {
+		return true
+	}
+	a, errA := filepath.Abs(repo)
+	b, errB := filepath.Abs(f.Path)
+	return errA == nil && errB == nil && a == b
+}
+
+func main() {
+	repoPath := flag.String("repo", "", "Path to the local Git repository")
+	reportPath := flag.String("report", "", "Execution report (JSON) of the run to revert")
+	repoName := flag.String("repo-name", "", "Name of this repository in the scenario's repo column; only its commits in --report are reverted (default: commits made in --repo)")
+	commitRange := flag.String("range", "", "Commit range produced by the run, e.g. abc123..def456 (alternative to --report)")
+	squash := flag.Bool("squash", false, "Create a single revert commit instead of one per reverted commit")
+	noPush := flag.Bool("no-push", false, "Create the revert commit(s) locally without pushing")
+	username := flag.String("username", "", "GitHub username")
+	token := flag.String("token", "", "GitHub personal access token")
+	flag.Parse()
+
+	if *repoPath == "" || (*reportPath == "") == (*commitRange == "") {
+		log.Fatal("Flag --repo and exactly one of --report or --range are required.")
+	}
+	if !*noPush && (*username == "" || *token == "") {
+		log.Fatal("Flags --username and --token are required unless --no-push is given.")
+	}
+
+	repo, err := git.PlainOpen(*repoPath)
+	if err != nil {
+		log.Fatalf("Failed to open repository at %s: %v", *repoPath, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		log.Fatalf("Failed to get worktree: %v", err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		log.Fatalf("Failed to read worktree status: %v", err)
+	}
+	if !status.IsClean() {
+		log.Fatal("Worktree has uncommitted changes. Commit or stash them before reverting.")
+	}
+
+	var hashes []plumbing.Hash
+	if *reportPath != "" {
+		hashes, err = commitsFromReport(*reportPath, repositoryFilter{Path: *repoPath, Name: *repoName})
+	} else {
+		hashes, err = commitsFromRange(repo, *commitRange)
+	}
+	if err != nil {
+		log.Fatalf("Failed to collect commits to revert: %v", err)
+	}
+	if len(hashes) == 0 {
+		log.Println("The run produced no commits. Nothing to revert.")
+		return
+	}
+
+	// Newest first: the run's commits in the order they appear on the current branch
+	runCommits, err := orderByHistory(repo, hashes)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	// A merge's changes against its first parent are the other side's work, not the run's
+	for _, c := range runCommits {
+		if c.NumParents() > 1 {
+			log.Fatalf("Refusing to revert: %s is a merge commit. Revert the run's own commits instead.", c.Hash.String()[:7])
+		}
+	}
+
+	touched := make(map[string]bool)
+	for _, c := range runCommits {
+		changes, err := commitChanges(c)
+		if err != nil {
+			log.Fatalf("Failed to diff commit %s: %v", c.Hash, err)
+		}
+		for _, name := range changedPaths(changes) {
+			touched[name] = true
+		}
+	}
+
+	conflicts, err := unrelatedChanges(repo, runCommits, touched)
+	if err != nil {
+		log.Fatalf("Failed to inspect history: %v", err)
+	}
+	if len(conflicts) > 0 {
+		for _, c := range conflicts {
+			log.Printf("Conflicting commit: %s", c)
+		}
+		log.Fatalf("Refusing to revert: %d commit(s) outside the run touched the same paths since.", len(conflicts))
+	}
+
+	author := &object.Signature{
+		Name:  *username,
+		Email: fmt.Sprintf("%s@example.com", *username),
+		When:  time.Now(),
+	}
+	if *username == "" {
+		author.Name, author.Email = "scenario-reverter", "scenario-reverter@example.com"
+	}
+
+	var reverted []string
+	for _, c := range runCommits {
+		if err := restoreParentState(worktree, *repoPath, c); err != nil {
+			log.Fatalf("Failed to revert %s: %v", c.Hash, err)
+		}
+		subject := strings.SplitN(c.Message, "\n", 2)[0]
+		reverted = append(reverted, fmt.Sprintf("%s %s", c.Hash.String()[:7], subject))
+
+		if *squash {
+			continue
+		}
+		msg := fmt.Sprintf("Revert %q\n\nThis reverts commit %s.\n", subject, c.Hash)
+		if _, err := worktree.Commit(msg, &git.CommitOptions{Author: author, AllowEmptyCommits: true}); err != nil {
+			log.Fatalf("Failed to commit revert of %s: %v", c.Hash, err)
+		}
+		log.Printf("Reverted %s", reverted[len(reverted)-1])
+	}
+
+	if *squash {
+		msg := fmt.Sprintf("Revert scenario run (%d commit(s))\n\nThis reverts commits:\n%s\n", len(reverted), strings.Join(reverted, "\n"))
+		if _, err := worktree.Commit(msg, &git.CommitOptions{Author: author, AllowEmptyCommits: true}); err != nil {
+			log.Fatalf("Failed to commit squashed revert: %v", err)
+		}
+		log.Printf("Reverted %d commit(s) in a single commit", len(reverted))
+	}
+
+	if *noPush {
+		log.Println("Revert commit(s) created locally. Skipping push (--no-push).")
+		return
+	}
+
+	err = repo.Push(&git.PushOptions{
+		Auth: &http.BasicAuth{
+			Username: *username, // can be anything except empty
+			Password: *token,
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to push: %v", err)
+	}
+
+	log.Println("Revert pushed to remote successfully.")
+}
+
+func commitsFromReport(reportPath string, repo repositoryFilter) ([]plumbing.Hash, error) {
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		return nil, err
+	}
+	var report executionReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid report %s: %v", reportPath, err)
+	}
+
+	// Delete executors share one commit across rows, so de-duplicate
+	seen := make(map[string]bool)
+	var hashes []plumbing.Hash
+	for _, r := range report.Results {
+		if r.Status != "success" || r.CommitSHA == "" || seen[r.CommitSHA] || !repo.matches(r.Repository) {
+			continue
+		}
+		seen[r.CommitSHA] = true
+		hashes = append(hashes, plumbing.NewHash(r.CommitSHA))
+	}
+	return hashes, nil
+}
+
+// commitsFromRange resolves "from..to" into the commits reachable from "to" but not "from".
+func commitsFromRange(repo *git.Repository, commitRange string) ([]plumbing.Hash, error) {
+	parts := strings.SplitN(commitRange, "..", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("range must look like <from>..<to>, got %q", commitRange)
+	}
+	from, err := repo.ResolveRevision(plumbing.Revision(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", parts[0], err)
+	}
+	to, err := repo.ResolveRevision(plumbing.Revision(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %v", parts[1], err)
+	}
+
+	iter, err := repo.Log(&git.LogOptions{From: *to})
+	if err != nil {
+		return nil, err
+	}
+	var hashes []plumbing.Hash
+	found := false
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.Hash == *from {
+			found = true
+			return storer.ErrStop
+		}
+		hashes = append(hashes, c.Hash)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not an ancestor of %s", parts[0], parts[1])
+	}
+	return hashes, nil
+}
+
+// orderByHistory returns the run's commits newest first, as they appear from HEAD.
+func orderByHistory(repo *git.Repository, hashes []plumbing.Hash) ([]*object.Commit, error) {
+	wanted := make(map[plumbing.Hash]bool)
+	for _, h := range hashes {
+		wanted[h] = true
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HEAD: %v", err)
+	}
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, err
+	}
+
+	var ordered []*object.Commit
+	err = iter.ForEach(func(c *object.Commit) error {
+		if wanted[c.Hash] {
+			ordered = append(ordered, c)
+			if len(ordered) == len(wanted) {
+				return storer.ErrStop
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ordered) != len(wanted) {
+		return nil, fmt.Errorf("only %d of %d commit(s) from the run are in the current branch history", len(ordered), len(wanted))
+	}
+	return ordered, nil
+}
+
+// unrelatedChanges lists commits made after the run started that are not part of the
+// run but touch one of the run's paths. Reverting over them would discard their work.
+func unrelatedChanges(repo *git.Repository, runCommits []*object.Commit, touched map[string]bool) ([]string, error) {
+	inRun := make(map[plumbing.Hash]bool)
+	for _, c := range runCommits {
+		inRun[c.Hash] = true
+	}
+	oldest := runCommits[len(runCommits)-1].Hash
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	iter, err := repo.Log(&git.LogOptions{From: head.Hash()})
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.Hash == oldest {
+			return storer.ErrStop
+		}
+		if inRun[c.Hash] {
+			return nil
+		}
+		changes, err := commitChanges(c)
+		if err != nil {
+			return err
+		}
+		for _, name := range changedPaths(changes) {
+			if touched[name] {
+				conflicts = append(conflicts, fmt.Sprintf("%s %s (%s)", c.Hash.String()[:7], strings.SplitN(c.Message, "\n", 2)[0], name))
+				break
+			}
+		}
+		return nil
+	})
+	return conflicts, err
+}
+
+// commitChanges diffs a commit against its first parent (or the empty tree).
+func commitChanges(c *object.Commit) (object.Changes, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	return object.DiffTree(parentTree, tree)
+}
+
+func changedPaths(changes object.Changes) []string {
+	var paths []string
+	for _, ch := range changes {
+		if ch.From.Name != "" {
+			paths = append(paths, ch.From.Name)
+		}
+		if ch.To.Name != "" && ch.To.Name != ch.From.Name {
+			paths = append(paths, ch.To.Name)
+		}
+	}
+	return paths
+}
+
+// restoreParentState puts every path changed by the commit back to its parent's version.
+func restoreParentState(worktree *git.Worktree, repoPath string, c *object.Commit) error {
+	changes, err := commitChanges(c)
+	if err != nil {
+		return err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return err
+		}
+	}
+
+	// Paths the commit added are removed first: one of them may be below a file the
+	// parent had, as when a file was replaced by a folder
+	var restore []*object.File
+	for _, name := range changedPaths(changes) {
+		fullPath := filepath.Join(repoPath, name)
+
+		var before *object.File
+		if parentTree != nil {
+			before, err = parentTree.File(name)
+			if err != nil && err != object.ErrFileNotFound {
+				return err
+			}
+		}
+
+		if before == nil {
+			// Added by the commit: remove it again
+			if _, err := worktree.Remove(name); err != nil {
+				return fmt.Errorf("failed to remove %s: %v", name, err)
+			}
+			removeEmptyParents(repoPath, filepath.Dir(fullPath))
+			continue
+		}
+		restore = append(restore, before)
+	}
+
+	for _, before := range restore {
+		name := before.Name
+		fullPath := filepath.Join(repoPath, name)
+		content, err := before.Contents()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return err
+		}
+		if err := writeEntry(fullPath, before.Mode, content); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", name, err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			return fmt.Errorf("failed to stage %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// writeEntry recreates a file the way the parent commit had it. Whatever is at fullPath
+// is removed first, so a symlink is replaced rather than written through and the mode
+// is the parent's, not the one the file has now; the index picks both up from disk.
+func writeEntry(fullPath string, mode filemode.FileMode, content string) error {
+	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	switch mode {
+	case filemode.Symlink:
+		return os.Symlink(content, fullPath)
+	case filemode.Executable:
+		return os.WriteFile(fullPath, []byte(content), 0755)
+	default:
+		return os.WriteFile(fullPath, []byte(content), 0644)
+	}
+}
+
+// removeEmptyParents deletes directories left empty by a revert, up to the repository root.
+func removeEmptyParents(repoPath, dir string) {
+	root := filepath.Clean(repoPath)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
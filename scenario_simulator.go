@@ -0,0 +1,1297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"gopkg.in/yaml.v3"
+)
+
+// Exit codes shared by all executors
+const (
+	exitSuccess        = 0 // every scenario line succeeded
+	exitPartialFailure = 1 // the run finished with failed lines
+	exitFatal          = 2 // the run could not start or could not be completed
+)
+
+type ScenarioOperation struct {
+	FilePath      string
+	OperationType string
+	CommitMessage string
+	FileContent   string
+	Author        string // optional "Name <email>" for the commit
+	TargetPath    string // destination for move operations
+	LineNumber    int
+	Origin        string    // file:line and loop values, for operations expanded from a YAML/JSON template
+	Repository    string    // repository name or path from the repo column; empty means --repo
+	Time          time.Time // when the operation originally happened; zero without a time column
+}
+
+// OperationResult records the outcome of a single scenario line, in the same form as the
+// executors' reports.
+type OperationResult struct {
+	LineNumber    int      `json:"line"`
+	FilePath      string   `json:"path"`
+	OperationType string   `json:"operation"`
+	CommitMessage string   `json:"message"`
+	Origin        string   `json:"origin,omitempty"`
+	Repository    string   `json:"repository,omitempty"`
+	Status        string   `json:"status"` // "success" or "failed"
+	Error         string   `json:"error,omitempty"`
+	CommitSHA     string   `json:"commit_sha,omitempty"`
+	FilesTouched  []string `json:"files_touched,omitempty"`
+}
+
+// SimulationReport is the executors' report plus what the simulated history ends in.
+type SimulationReport struct {
+	Executor     string             `json:"executor"`
+	Scenario     string             `json:"scenario"`
+	StartedAt    time.Time          `json:"started_at"`
+	FinishedAt   time.Time          `json:"finished_at"`
+	Total        int                `json:"total"`
+	Succeeded    int                `json:"succeeded"`
+	Failed       int                `json:"failed"`
+	Skipped      int                `json:"skipped"`
+	OpsPerSecond float64            `json:"ops_per_second"`
+	Repositories []SimulatedHistory `json:"repositories"`
+	Results      []OperationResult  `json:"results"`
+}
+
+// SimulatedHistory is the outcome for one repository: the commits the scenario made, in
+// order, and the tree the last one points to.
+type SimulatedHistory struct {
+	Name    string            `json:"name"`
+	Seed    string            `json:"seed,omitempty"` // local clone the simulation started from
+	Base    string            `json:"base,omitempty"` // commit the simulation started from
+	Head    string            `json:"head,omitempty"`
+	Tree    string            `json:"tree"`
+	Commits []SimulatedCommit `json:"commits"`
+}
+
+type SimulatedCommit struct {
+	SHA     string `json:"sha"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// RepositoryConfig is one entry of the --repos map, as for the create/update executor.
+// Only the path is used, as the seed for that repository.
+type RepositoryConfig struct {
+	Path   string `json:"path" yaml:"path"`
+	Remote string `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+// simulation is one in-memory repository the scenario runs against. Files live in a memfs
+// worktree; the branch tree is mirrored per directory so that a commit only re-encodes the
+// directories a row changed, instead of rebuilding the whole tree from the index.
+type simulation struct {
+	history SimulatedHistory
+	repo    *git.Repository
+	fs      billy.Filesystem
+	branch  plumbing.ReferenceName
+	head    plumbing.Hash
+	tree    plumbing.Hash
+	dirs    map[string]map[string]object.TreeEntry // "" is the root directory
+	dirty   map[string]bool
+	clock   time.Time // commit time for rows without a time column
+}
+
+// defaultSignature is used for commits whose row has no author.
+var defaultSignature = object.Signature{Name: "scenario-simulator", Email: "scenario-simulator@example.com"}
+
+func main() {
+	scenarioPath := flag.String("scenario", "", "Path to the scenario (CSV, YAML or JSON) to simulate")
+	repoPath := flag.String("repo", "", "Local clone to start rows without a repo column from (default: an empty repository)")
+	reposPath := flag.String("repos", "", "YAML/JSON file mapping repo column names to local clones to start from (optional)")
+	ref := flag.String("ref", "", "Revision of the seed clones to start from (default: their HEAD)")
+	reportPath := flag.String("report", "", "Path to write the JSON simulation report (optional)")
+	showCommits := flag.Bool("commits", false, "Print every simulated commit")
+	flag.Parse()
+
+	if *scenarioPath == "" {
+		log.Fatal("Flag --scenario is required.")
+	}
+
+	operations, err := readScenario(*scenarioPath)
+	if err != nil {
+		log.Fatalf("Failed to read scenario: %v", err)
+	}
+	repos := map[string]RepositoryConfig{}
+	if *reposPath != "" {
+		if repos, err = readRepositoryMap(*reposPath); err != nil {
+			log.Fatalf("Failed to read repository map: %v", err)
+		}
+	}
+
+	report := SimulationReport{Executor: "memory", Scenario: *scenarioPath, StartedAt: time.Now(), Total: len(operations)}
+
+	// One in-memory repository per repo column value, in order of first appearance
+	simulations := map[string]*simulation{}
+	var order []string
+	for _, op := range operations {
+		name := op.Repository
+		if name == "" {
+			name = *repoPath
+		}
+		sim, ok := simulations[name]
+		if !ok {
+			// --repo and --repos paths must exist; a repo column value without a mapping
+			// names a clone that may not have been made yet
+			seed := name
+			if config, ok := repos[name]; ok {
+				seed = config.Path
+			} else if op.Repository != "" {
+				if _, err := os.Stat(seed); os.IsNotExist(err) {
+					log.Printf("No clone named %s, simulating it from an empty repository", seed)
+					seed = ""
+				}
+			}
+			if sim, err = newSimulation(name, seed, *ref); err != nil {
+				log.Fatalf("Failed to prepare repository %q: %v", name, err)
+			}
+			simulations[name] = sim
+			order = append(order, name)
+		}
+
+		result := OperationResult{
+			LineNumber:    op.LineNumber,
+			FilePath:      op.FilePath,
+			OperationType: op.OperationType,
+			CommitMessage: op.CommitMessage,
+			Origin:        op.Origin,
+			Repository:    op.Repository,
+		}
+		if err := sim.apply(op, &result); err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			report.Failed++
+			where := fmt.Sprintf("line %d", op.LineNumber)
+			if op.Origin != "" {
+				where = op.Origin
+			}
+			log.Printf("%s: %v", where, err)
+		} else {
+			result.Status = "success"
+			report.Succeeded++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	for _, name := range order {
+		sim := simulations[name]
+		if err := sim.finish(); err != nil {
+			log.Fatalf("Failed to read the result of %q: %v", name, err)
+		}
+		report.Repositories = append(report.Repositories, sim.history)
+	}
+
+	report.FinishedAt = time.Now()
+	elapsed := report.FinishedAt.Sub(report.StartedAt)
+	if elapsed > 0 {
+		report.OpsPerSecond = float64(len(operations)) / elapsed.Seconds()
+	}
+
+	commits := 0
+	for _, history := range report.Repositories {
+		commits += len(history.Commits)
+	}
+	fmt.Printf("Simulated %d operation(s) in %s (%.0f ops/s): %d succeeded, %d failed, %d commit(s).\n",
+		len(operations), elapsed.Round(time.Millisecond), report.OpsPerSecond, report.Succeeded, report.Failed, commits)
+	for _, history := range report.Repositories {
+		name := history.Name
+		if name == "" {
+			name = "(empty repository)"
+		}
+		fmt.Printf("%s: head %s, tree %s\n", name, history.Head, history.Tree)
+		if *showCommits {
+			for _, c := range history.Commits {
+				fmt.Printf("  %s line %d: %s\n", c.SHA[:7], c.Line, c.Message)
+			}
+		}
+	}
+
+	if *reportPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportPath, data, 0644)
+		}
+		if err != nil {
+			log.Printf("Failed to write report: %v", err)
+		}
+	}
+	if report.Failed > 0 {
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// newSimulation creates the in-memory repository for one repo value. An empty seed starts
+// an empty repository; otherwise seed must be a local clone, which is cloned into memory
+// and checked out at ref.
+func newSimulation(name, seed, ref string) (*simulation, error) {
+	sim := &simulation{
+		history: SimulatedHistory{Name: name},
+		dirs:    map[string]map[string]object.TreeEntry{"": {}},
+		dirty:   map[string]bool{},
+		clock:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	sim.fs = memfs.New()
+	var err error
+
+	if seed == "" {
+		if sim.repo, err = git.Init(memory.NewStorage(), sim.fs); err != nil {
+			return nil, err
+		}
+		sim.branch = plumbing.Master
+		sim.tree = plumbing.ComputeHash(plumbing.TreeObject, nil)
+		return sim, nil
+	}
+
+	if info, err := os.Stat(seed); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", seed)
+	}
+	abs, err := filepath.Abs(seed)
+	if err != nil {
+		return nil, err
+	}
+	if sim.repo, err = git.Clone(memory.NewStorage(), sim.fs, &git.CloneOptions{URL: abs}); err != nil {
+		return nil, fmt.Errorf("failed to clone %s into memory: %v", seed, err)
+	}
+	if ref != "" {
+		hash, err := sim.repo.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s in %s: %v", ref, seed, err)
+		}
+		worktree, err := sim.repo.Worktree()
+		if err != nil {
+			return nil, err
+		}
+		if err := worktree.Reset(&git.ResetOptions{Commit: *hash, Mode: git.HardReset}); err != nil {
+			return nil, err
+		}
+	}
+	head, err := sim.repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	base, err := sim.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	tree, err := base.Tree()
+	if err != nil {
+		return nil, err
+	}
+	if err := sim.loadTree(tree, ""); err != nil {
+		return nil, err
+	}
+	sim.branch = head.Name()
+	sim.head = base.Hash
+	sim.tree = base.TreeHash
+	sim.clock = base.Committer.When
+	sim.history.Seed = abs
+	sim.history.Base = base.Hash.String()
+	return sim, nil
+}
+
+// loadTree mirrors a committed tree into sim.dirs.
+func (sim *simulation) loadTree(tree *object.Tree, dir string) error {
+	entries := map[string]object.TreeEntry{}
+	sim.dirs[dir] = entries
+	for _, entry := range tree.Entries {
+		entries[entry.Name] = entry
+		if entry.Mode != filemode.Dir {
+			continue
+		}
+		subtree, err := tree.Tree(entry.Name)
+		if err != nil {
+			return err
+		}
+		if err := sim.loadTree(subtree, path.Join(dir, entry.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply runs one row the way the create/update executor does: change the worktree, stage
+// the change and commit it, skipping the commit when nothing changed.
+func (sim *simulation) apply(op ScenarioOperation, result *OperationResult) error {
+	touched := []string{op.FilePath}
+
+	switch op.OperationType {
+	case "create", "update":
+		if _, err := sim.fs.Lstat(op.FilePath); op.OperationType == "update" && err != nil {
+			return fmt.Errorf("file does not exist for update: %s", op.FilePath)
+		}
+		if err := sim.fs.MkdirAll(path.Dir(op.FilePath), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %v", path.Dir(op.FilePath), err)
+		}
+		if err := util.WriteFile(sim.fs, op.FilePath, []byte(op.FileContent), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", op.FilePath, err)
+		}
+		hash, err := sim.storeBlob([]byte(op.FileContent))
+		if err != nil {
+			return err
+		}
+		sim.setEntry(op.FilePath, hash, filemode.Regular)
+	case "delete":
+		if len(sim.trackedFiles(op.FilePath)) == 0 {
+			return fmt.Errorf("pathspec %s did not match any files", op.FilePath)
+		}
+		sim.removeEntry(op.FilePath)
+		util.RemoveAll(sim.fs, op.FilePath)
+	case "move":
+		moved, err := sim.move(op.FilePath, op.TargetPath)
+		if err != nil {
+			return err
+		}
+		touched = append(moved, op.TargetPath)
+	default:
+		return fmt.Errorf("unknown operation type: %s", op.OperationType)
+	}
+
+	tree, err := sim.writeTrees()
+	if err != nil {
+		return fmt.Errorf("failed to write tree: %v", err)
+	}
+	if tree == sim.tree {
+		return nil // no changes to commit, as the executor skips the commit
+	}
+
+	author := defaultSignature
+	if op.Author != "" {
+		author = parseSignature(op.Author)
+	}
+	author.When = op.Time
+	if author.When.IsZero() {
+		sim.clock = sim.clock.Add(time.Second)
+		author.When = sim.clock
+	}
+	committer := defaultSignature
+	committer.When = author.When
+
+	commit := &object.Commit{Author: author, Committer: committer, Message: op.CommitMessage + "\n", TreeHash: tree}
+	if !sim.head.IsZero() {
+		commit.ParentHashes = []plumbing.Hash{sim.head}
+	}
+	obj := sim.repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	hash, err := sim.repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	if err := sim.repo.Storer.SetReference(plumbing.NewHashReference(sim.branch, hash)); err != nil {
+		return fmt.Errorf("failed to update %s: %v", sim.branch, err)
+	}
+	sim.head, sim.tree = hash, tree
+
+	result.CommitSHA = hash.String()
+	result.FilesTouched = touched
+	sim.history.Commits = append(sim.history.Commits, SimulatedCommit{SHA: hash.String(), Line: op.LineNumber, Message: op.CommitMessage})
+	return nil
+}
+
+// move moves a file, or every tracked file under a folder, like git mv.
+func (sim *simulation) move(from, to string) ([]string, error) {
+	files := sim.trackedFiles(from)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("bad source %s: not under version control", from)
+	}
+	if _, err := sim.fs.Lstat(to); err == nil {
+		return nil, fmt.Errorf("destination %s already exists", to)
+	}
+
+	for _, file := range files {
+		entry, _ := sim.entry(file)
+		target := to + strings.TrimPrefix(file, from)
+		if err := sim.fs.MkdirAll(path.Dir(target), 0755); err != nil {
+			return nil, err
+		}
+		if err := sim.fs.Rename(file, target); err != nil {
+			return nil, fmt.Errorf("failed to move %s to %s: %v", file, target, err)
+		}
+		sim.setEntry(target, entry.Hash, entry.Mode)
+	}
+	sim.removeEntry(from)
+	util.RemoveAll(sim.fs, from)
+	if len(files) == 1 && files[0] == from {
+		return nil, nil
+	}
+	return files, nil
+}
+
+func (sim *simulation) storeBlob(content []byte) (plumbing.Hash, error) {
+	obj := sim.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	obj.SetSize(int64(len(content)))
+	writer, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	writer.Close()
+	return sim.repo.Storer.SetEncodedObject(obj)
+}
+
+func splitPath(p string) (string, string) {
+	dir, name := path.Split(p)
+	return strings.TrimSuffix(dir, "/"), name
+}
+
+func (sim *simulation) entry(p string) (object.TreeEntry, bool) {
+	dir, name := splitPath(p)
+	entry, ok := sim.dirs[dir][name]
+	return entry, ok
+}
+
+// markDirty marks dir and every directory above it for re-encoding.
+func (sim *simulation) markDirty(dir string) {
+	for {
+		sim.dirty[dir] = true
+		if dir == "" {
+			return
+		}
+		dir, _ = splitPath(dir)
+	}
+}
+
+// setEntry records a file in the tree, creating the directories above it.
+func (sim *simulation) setEntry(p string, hash plumbing.Hash, mode filemode.FileMode) {
+	dir, name := splitPath(p)
+	for child := dir; child != ""; {
+		if _, ok := sim.dirs[child]; ok {
+			break
+		}
+		sim.dirs[child] = map[string]object.TreeEntry{}
+		parent, childName := splitPath(child)
+		if _, ok := sim.dirs[parent]; !ok {
+			sim.dirs[parent] = map[string]object.TreeEntry{}
+		}
+		sim.dirs[parent][childName] = object.TreeEntry{Name: childName, Mode: filemode.Dir}
+		child = parent
+	}
+	sim.dirs[dir][name] = object.TreeEntry{Name: name, Mode: mode, Hash: hash}
+	sim.markDirty(dir)
+}
+
+// removeEntry removes a file or a whole directory from the tree.
+func (sim *simulation) removeEntry(p string) {
+	if _, ok := sim.dirs[p]; ok {
+		for dir := range sim.dirs {
+			if dir == p || strings.HasPrefix(dir, p+"/") {
+				delete(sim.dirs, dir)
+				delete(sim.dirty, dir)
+			}
+		}
+	}
+	dir, name := splitPath(p)
+	delete(sim.dirs[dir], name)
+	sim.markDirty(dir)
+}
+
+// trackedFiles returns the files at p: p itself if it is a file, or every file below it.
+func (sim *simulation) trackedFiles(p string) []string {
+	if entry, ok := sim.entry(p); ok && entry.Mode != filemode.Dir {
+		return []string{p}
+	}
+	var files []string
+	for dir, entries := range sim.dirs {
+		if dir != p && !strings.HasPrefix(dir, p+"/") {
+			continue
+		}
+		for name, entry := range entries {
+			if entry.Mode != filemode.Dir {
+				files = append(files, path.Join(dir, name))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// writeTrees encodes the changed directories, deepest first, and returns the root tree.
+// Directories left empty disappear, as they do in git.
+func (sim *simulation) writeTrees() (plumbing.Hash, error) {
+	var dirs []string
+	for dir := range sim.dirty {
+		dirs = append(dirs, dir)
+	}
+	depth := func(dir string) int {
+		if dir == "" {
+			return 0
+		}
+		return strings.Count(dir, "/") + 1
+	}
+	sort.Slice(dirs, func(i, j int) bool { return depth(dirs[i]) > depth(dirs[j]) })
+
+	root := sim.tree
+	for _, dir := range dirs {
+		entries, exists := sim.dirs[dir]
+		parent, name := splitPath(dir)
+		if dir != "" && (!exists || len(entries) == 0) {
+			delete(sim.dirs, dir)
+			if _, ok := sim.dirs[parent]; ok {
+				delete(sim.dirs[parent], name)
+			}
+			continue
+		}
+
+		tree := &object.Tree{}
+		for _, entry := range entries {
+			tree.Entries = append(tree.Entries, entry)
+		}
+		sort.Slice(tree.Entries, func(i, j int) bool {
+			return treeSortKey(tree.Entries[i]) < treeSortKey(tree.Entries[j])
+		})
+		obj := sim.repo.Storer.NewEncodedObject()
+		if err := tree.Encode(obj); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		hash, err := sim.repo.Storer.SetEncodedObject(obj)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if dir == "" {
+			root = hash
+		} else {
+			sim.dirs[parent][name] = object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash}
+		}
+	}
+	sim.dirty = map[string]bool{}
+	return root, nil
+}
+
+// treeSortKey orders tree entries the way git does: directories sort as if their name
+// ended with a slash.
+func treeSortKey(entry object.TreeEntry) string {
+	if entry.Mode == filemode.Dir {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// finish records where the simulated history ended.
+func (sim *simulation) finish() error {
+	if !sim.head.IsZero() {
+		sim.history.Head = sim.head.String()
+	}
+	sim.history.Tree = sim.tree.String()
+	return nil
+}
+
+// parseSignature reads "Name <email>"; a value without an email is used as the name.
+func parseSignature(author string) object.Signature {
+	if open := strings.LastIndex(author, "<"); open >= 0 && strings.HasSuffix(author, ">") {
+		return object.Signature{Name: strings.TrimSpace(author[:open]), Email: author[open+1 : len(author)-1]}
+	}
+	return object.Signature{Name: author, Email: defaultSignature.Email}
+}
+
+// readScenario picks the scenario format from the file extension: .yaml, .yml and .json
+// are documents, anything else is CSV.
+func readScenario(filename string) ([]ScenarioOperation, error) {
+	if !isScenarioDocument(filename) {
+		return readScenarioCSV(filename)
+	}
+
+	documentOps, err := readScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []ScenarioOperation
+	for _, d := range documentOps {
+		switch d.Op {
+		case "create", "update", "delete", "move":
+		default:
+			return nil, fmt.Errorf("invalid operation type '%s' at %s: must be 'create', 'update', 'delete' or 'move'", d.Op, d.Origin)
+		}
+		if d.Op == "move" && d.Target == "" {
+			return nil, fmt.Errorf("move operation at %s needs a target", d.Origin)
+		}
+		opTime, err := parseScenarioTime(d.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time at %s: %v", d.Origin, err)
+		}
+		operations = append(operations, ScenarioOperation{
+			FilePath:      d.Path,
+			OperationType: d.Op,
+			CommitMessage: d.Message,
+			FileContent:   d.Content,
+			Author:        d.Author,
+			TargetPath:    d.Target,
+			LineNumber:    d.Line,
+			Origin:        d.Origin,
+			Repository:    d.Repo,
+			Time:          opTime,
+		})
+	}
+	return operations, nil
+}
+
+func readScenarioCSV(filename string) ([]ScenarioOperation, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	// Make CSV parsing more flexible
+	reader.FieldsPerRecord = -1 // Allow variable number of fields
+	reader.TrimLeadingSpace = true
+
+	var operations []ScenarioOperation
+	var positions []int
+	headerChecked := false
+	version := 1
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV parsing error: %v", err)
+		}
+		// The line the record starts on, counting blank lines and the lines of
+		// multi-line fields
+		lineNumber, _ := reader.FieldPos(0)
+
+		// Skip empty lines
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
+		}
+
+		// The first non-empty rows may be a format marker and a header naming the columns
+		if !headerChecked {
+			if version == 1 {
+				v, isMarker, err := parseFormatMarker(record)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				if isMarker {
+					version = v
+					continue
+				}
+			}
+			headerChecked = true
+			var isHeader bool
+			positions, isHeader, err = parseHeader(record)
+			if err != nil {
+				return nil, fmt.Errorf("invalid header at line %d: %v", lineNumber, err)
+			}
+			if isHeader {
+				continue
+			}
+			if version >= 2 {
+				return nil, fmt.Errorf("scenario format %d requires a header row at line %d", version, lineNumber)
+			}
+		}
+		if positions != nil {
+			record = reorderRecord(record, positions)
+		}
+
+		// Validate minimum required fields
+		if len(record) < 3 {
+			return nil, fmt.Errorf("invalid CSV format at line %d: expected at least 3 columns, got %d columns. Record: %v", lineNumber, len(record), record)
+		}
+
+		// Trim whitespace from all fields
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+
+		op := ScenarioOperation{
+			FilePath:      record[0],
+			OperationType: record[1],
+			CommitMessage: record[2],
+			LineNumber:    lineNumber,
+		}
+
+		// Validate operation type
+		switch op.OperationType {
+		case "create", "update", "delete", "move":
+		default:
+			return nil, fmt.Errorf("invalid operation type '%s' at line %d: must be 'create', 'update', 'delete' or 'move'", op.OperationType, lineNumber)
+		}
+
+		// Add file content if available (for create and update operations)
+		if len(record) > 3 && strings.TrimSpace(record[3]) != "" {
+			op.FileContent = record[3]
+		} else if op.OperationType == "update" && version < 2 {
+			// Format version 1 filled updates without content with a placeholder
+			op.FileContent = "test data"
+		}
+
+		// "@file:<path>" loads the content from a file next to the scenario, keeping
+		// whitespace and newlines that CSV trimming would otherwise lose
+		if strings.HasPrefix(op.FileContent, "@file:") {
+			contentPath := strings.TrimPrefix(op.FileContent, "@file:")
+			if !filepath.IsAbs(contentPath) {
+				contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+			}
+			content, err := os.ReadFile(contentPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read content reference at line %d: %v", lineNumber, err)
+			}
+			op.FileContent = string(content)
+		}
+
+		// Optional author, move target and repository columns
+		if len(record) > 4 {
+			op.Author = record[4]
+		}
+		if len(record) > 5 {
+			op.TargetPath = record[5]
+		}
+		if len(record) > 6 {
+			op.Repository = record[6]
+		}
+		if len(record) > 7 {
+			if op.Time, err = parseScenarioTime(record[7]); err != nil {
+				return nil, fmt.Errorf("invalid time at line %d: %v", lineNumber, err)
+			}
+		}
+		if op.OperationType == "move" && op.TargetPath == "" {
+			return nil, fmt.Errorf("move operation at line %d needs a target path in column 6", lineNumber)
+		}
+
+		operations = append(operations, op)
+	}
+
+	return operations, nil
+}
+
+// parseScenarioTime reads the optional time column. Empty means the operation has no time.
+func parseScenarioTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ScenarioDocument is the YAML/JSON form of a scenario. Operations map onto the CSV
+// columns; content is taken verbatim, so multi-line content needs no "@file:" reference.
+// Vars are defaults for "${name}" placeholders and can be overridden by an include.
+type ScenarioDocument struct {
+	Format     int                 `json:"format,omitempty" yaml:"format,omitempty"`
+	Vars       map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Operations []DocumentOperation `json:"operations" yaml:"operations"`
+}
+
+// DocumentOperation is one entry of a ScenarioDocument: an operation, an include of
+// another document, or a for loop over Do. Expansion leaves only operations.
+type DocumentOperation struct {
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	Op          string `json:"op,omitempty" yaml:"op,omitempty"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+	Content     string `json:"content,omitempty" yaml:"content,omitempty"`
+	ContentFile string `json:"content_file,omitempty" yaml:"content_file,omitempty"` // relative to the scenario
+	Author      string `json:"author,omitempty" yaml:"author,omitempty"`
+	Target      string `json:"target,omitempty" yaml:"target,omitempty"`
+	Repo        string `json:"repo,omitempty" yaml:"repo,omitempty"` // repository name or path, for multi-repository runs
+	Time        string `json:"time,omitempty" yaml:"time,omitempty"` // RFC 3339 time of the operation, for time-scaled replay
+
+	Include string              `json:"include,omitempty" yaml:"include,omitempty"` // document to splice in, relative to this one
+	Vars    map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`       // extra variables for the include or loop body
+	For     string              `json:"for,omitempty" yaml:"for,omitempty"`         // loop variable name
+	In      []string            `json:"in,omitempty" yaml:"in,omitempty"`           // values to loop over
+	Range   string              `json:"range,omitempty" yaml:"range,omitempty"`     // or an integer range "first..last"
+	Pad     int                 `json:"pad,omitempty" yaml:"pad,omitempty"`         // zero-pad range values to this width
+	Do      []DocumentOperation `json:"do,omitempty" yaml:"do,omitempty"`
+
+	Line   int    `json:"-" yaml:"-"`
+	Origin string `json:"-" yaml:"-"` // file:line and loop values the operation was expanded from
+}
+
+// placeholder matches "${name}", and "$${name}", which stands for a literal "${name}".
+var placeholder = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isScenarioDocument reports whether the file extension selects the YAML or JSON format.
+func isScenarioDocument(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readScenarioDocument loads a YAML or JSON scenario and expands its includes, loops and
+// variables. Each operation keeps the line it was written on and an Origin naming the
+// file and loop values, and content_file references are read into Content.
+func readScenarioDocument(filename string) ([]DocumentOperation, error) {
+	return expandDocument(filename, nil, "", nil)
+}
+
+func expandDocument(filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, included := range stack {
+		if included == abs {
+			return nil, fmt.Errorf("include cycle: %s is already being expanded", filename)
+		}
+	}
+
+	doc, err := loadScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables passed by an include win over the document's defaults
+	scope := make(map[string]string)
+	for name, value := range doc.Vars {
+		scope[name] = value
+	}
+	for name, value := range vars {
+		scope[name] = value
+	}
+	return expandItems(doc.Operations, filename, scope, bindings, append(stack, abs))
+}
+
+func expandItems(items []DocumentOperation, filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	var ops []DocumentOperation
+	for _, item := range items {
+		where := fmt.Sprintf("%s:%d", filename, item.Line)
+		scope, err := withVars(vars, item.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+
+		switch {
+		case item.Include != "" && item.For != "":
+			return nil, fmt.Errorf("%s: an entry cannot be both an include and a for loop", where)
+		case item.Include != "" || item.For != "":
+			if item.Path != "" || item.Op != "" {
+				return nil, fmt.Errorf("%s: include and for entries cannot also be operations", where)
+			}
+		}
+
+		switch {
+		case item.Include != "":
+			name, err := substitute(item.Include, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(filename), name)
+			}
+			included, err := expandDocument(name, scope, bindings, stack)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			ops = append(ops, included...)
+
+		case item.For != "":
+			values, err := loopValues(item, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			for _, value := range values {
+				body := make(map[string]string, len(scope)+1)
+				for name, v := range scope {
+					body[name] = v
+				}
+				body[item.For] = value
+				expanded, err := expandItems(item.Do, filename, body, fmt.Sprintf("%s %s=%s", bindings, item.For, value), stack)
+				if err != nil {
+					return nil, err
+				}
+				ops = append(ops, expanded...)
+			}
+
+		default:
+			op, err := expandOperation(item, filename, scope, stack[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			op.Origin = where
+			if bindings != "" {
+				op.Origin += " [" + strings.TrimSpace(bindings) + "]"
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// expandOperation fills in the placeholders of one operation and loads its content_file.
+// The content_file reference is rewritten relative to the top-level document.
+func expandOperation(item DocumentOperation, filename string, vars map[string]string, topLevel string) (DocumentOperation, error) {
+	op := DocumentOperation{Line: item.Line}
+	fields := []struct {
+		from string
+		to   *string
+	}{
+		{item.Path, &op.Path}, {item.Op, &op.Op}, {item.Message, &op.Message}, {item.Content, &op.Content},
+		{item.ContentFile, &op.ContentFile}, {item.Author, &op.Author}, {item.Target, &op.Target}, {item.Repo, &op.Repo}, {item.Time, &op.Time},
+	}
+	for _, field := range fields {
+		value, err := substitute(field.from, vars)
+		if err != nil {
+			return op, err
+		}
+		*field.to = value
+	}
+
+	if op.Path == "" || op.Op == "" {
+		return op, fmt.Errorf("operation needs a path and an op")
+	}
+	if op.ContentFile == "" {
+		return op, nil
+	}
+	if op.Content != "" {
+		return op, fmt.Errorf("operation has both content and content_file")
+	}
+	contentPath := op.ContentFile
+	if !filepath.IsAbs(contentPath) {
+		contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+		if abs, err := filepath.Abs(contentPath); err == nil {
+			if rel, err := filepath.Rel(filepath.Dir(topLevel), abs); err == nil {
+				op.ContentFile = filepath.ToSlash(rel)
+			}
+		}
+	}
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		return op, fmt.Errorf("failed to read content_file: %v", err)
+	}
+	op.Content = string(content)
+	return op, nil
+}
+
+// withVars returns vars extended by extra, whose values may use the variables in vars.
+func withVars(vars, extra map[string]string) (map[string]string, error) {
+	if len(extra) == 0 {
+		return vars, nil
+	}
+	scope := make(map[string]string, len(vars)+len(extra))
+	for name, value := range vars {
+		scope[name] = value
+	}
+	for name, value := range extra {
+		expanded, err := substitute(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		scope[name] = expanded
+	}
+	return scope, nil
+}
+
+// loopValues returns the values of a for loop: the "in" list, or the "range" first..last
+// zero-padded to "pad" digits.
+func loopValues(item DocumentOperation, vars map[string]string) ([]string, error) {
+	if (len(item.In) > 0) == (item.Range != "") {
+		return nil, fmt.Errorf("for %s needs exactly one of \"in\" and \"range\"", item.For)
+	}
+
+	var values []string
+	for _, v := range item.In {
+		value, err := substitute(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if item.Range == "" {
+		return values, nil
+	}
+
+	bounds, err := substitute(item.Range, vars)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(bounds, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("range must look like <first>..<last>, got %q", bounds)
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	last, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || last < first {
+		return nil, fmt.Errorf("invalid range %q", bounds)
+	}
+	for n := first; n <= last; n++ {
+		values = append(values, fmt.Sprintf("%0*d", item.Pad, n))
+	}
+	return values, nil
+}
+
+// substitute replaces "${name}" placeholders; an undefined variable is an error.
+// "$${name}" is kept as a literal "${name}".
+func substitute(s string, vars map[string]string) (string, error) {
+	var missing []string
+	result := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable ${%s}", missing[0])
+	}
+	return result, nil
+}
+
+// loadScenarioDocument decodes one YAML or JSON file, rejecting unknown fields, and
+// records the line every entry starts on.
+func loadScenarioDocument(filename string) (ScenarioDocument, error) {
+	var doc ScenarioDocument
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return doc, err
+	}
+
+	isJSON := strings.ToLower(filepath.Ext(filename)) == ".json"
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid JSON scenario %s: %v", filename, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid YAML scenario %s: %v", filename, err)
+		}
+	}
+	if doc.Format != 0 && doc.Format != currentFormatVersion {
+		return doc, fmt.Errorf("unsupported scenario format %d in %s (YAML and JSON scenarios use format %d)", doc.Format, filename, currentFormatVersion)
+	}
+
+	// JSON is read through the YAML parser too, just for line numbers; if that fails
+	// (e.g. tab indentation) only top-level entries get exact lines
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err == nil && root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		assignLines(doc.Operations, mappingValue(root.Content[0], "operations"), 0)
+	} else if isJSON {
+		for i, line := range jsonOperationLines(data) {
+			if i < len(doc.Operations) {
+				assignLines(doc.Operations[i:i+1], nil, line)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// assignLines copies the line of every sequence element onto items, recursing into
+// "do"; without a node the items inherit parentLine.
+func assignLines(items []DocumentOperation, seq *yaml.Node, parentLine int) {
+	for i := range items {
+		items[i].Line = parentLine
+		var node *yaml.Node
+		if seq != nil && seq.Kind == yaml.SequenceNode && i < len(seq.Content) {
+			node = seq.Content[i]
+			items[i].Line = node.Line
+		}
+		assignLines(items[i].Do, mappingValue(node, "do"), items[i].Line)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// jsonOperationLines returns the line each element of the top-level "operations" array starts on.
+func jsonOperationLines(data []byte) []int {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		var skip json.RawMessage
+		if key != "operations" {
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+			continue
+		}
+		if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil
+		}
+		var lines []int
+		for decoder.More() {
+			// InputOffset is just past the previous token; skip to the element itself
+			offset := int(decoder.InputOffset())
+			for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+				offset++
+			}
+			lines = append(lines, 1+bytes.Count(data[:offset], []byte("\n")))
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+// currentFormatVersion is the scenario format written by the tools in this repository.
+// Version 1 is the original headerless layout; version 2 starts with a
+// "#scenario-format: 2" line followed by a header row, and an update without content
+// writes an empty file instead of the "test data" placeholder.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
+
+// parseFormatMarker reports whether record is a "#scenario-format: N" line and returns N.
+func parseFormatMarker(record []string) (int, bool, error) {
+	if len(record) != 1 || !strings.HasPrefix(strings.TrimSpace(record[0]), formatMarker) {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), formatMarker)))
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid format marker %q", record[0])
+	}
+	if version > currentFormatVersion {
+		return version, true, fmt.Errorf("scenario format %d is newer than this tool supports (%d)", version, currentFormatVersion)
+	}
+	return version, true, nil
+}
+
+// scenarioColumns is the legacy positional layout. A header row may name these columns
+// in any order; files without one keep using the positions.
+var scenarioColumns = []string{"path", "op", "message", "content", "author", "target", "repo", "time"}
+
+// columnAliases are alternative header spellings.
+var columnAliases = map[string]string{
+	"operation":   "op",
+	"file":        "path",
+	"commit":      "message",
+	"target_path": "target",
+	"repository":  "repo",
+}
+
+// parseHeader reports whether record is a header row (it names both "path" and "op") and
+// returns, for every entry of scenarioColumns, the index it appears at or -1. Unknown
+// column names are an error so that a typo does not silently drop data; columns starting
+// with "x-" are free-form and ignored.
+func parseHeader(record []string) ([]int, bool, error) {
+	names := make([]string, len(record))
+	isHeader := map[string]bool{}
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		names[i] = name
+		isHeader[name] = true
+	}
+	if !isHeader["path"] || !isHeader["op"] {
+		return nil, false, nil
+	}
+
+	positions := make([]int, len(scenarioColumns))
+	for i := range positions {
+		positions[i] = -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		column := -1
+		for j, known := range scenarioColumns {
+			if name == known {
+				column = j
+			}
+		}
+		if column < 0 {
+			return nil, true, fmt.Errorf("unknown column %q in header (known: %s; prefix custom columns with x-)", record[i], strings.Join(scenarioColumns, ", "))
+		}
+		if positions[column] >= 0 {
+			return nil, true, fmt.Errorf("column %q appears more than once in header", name)
+		}
+		positions[column] = i
+	}
+	if positions[2] < 0 {
+		return nil, true, fmt.Errorf("header has no %q column", "message")
+	}
+	return positions, true, nil
+}
+
+// reorderRecord returns record in the legacy positional layout described by positions.
+func reorderRecord(record []string, positions []int) []string {
+	var reordered []string
+	for column, index := range positions {
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		for len(reordered) < column {
+			reordered = append(reordered, "")
+		}
+		reordered = append(reordered, record[index])
+	}
+	return reordered
+}
+
+// readRepositoryMap loads the --repos file: a YAML or JSON object from repository name to
+// its path (relative to the map file) and optional remote.
+func readRepositoryMap(filename string) (map[string]RepositoryConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	repos := map[string]RepositoryConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&repos); err != nil {
+		return nil, fmt.Errorf("invalid repository map %s: %v", filename, err)
+	}
+	for name, repo := range repos {
+		if repo.Path == "" {
+			return nil, fmt.Errorf("repository %q in %s has no path", name, filename)
+		}
+		if !filepath.IsAbs(repo.Path) {
+			repo.Path = filepath.Join(filepath.Dir(filename), repo.Path)
+			repos[name] = repo
+		}
+	}
+	return repos, nil
+}
@@ -0,0 +1,896 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"gopkg.in/yaml.v3"
+)
+
+// scenarioList lets --scenario be given more than once; files are applied in order.
+type scenarioList []string
+
+func (s *scenarioList) String() string     { return strings.Join(*s, ",") }
+func (s *scenarioList) Set(v string) error { *s = append(*s, v); return nil }
+
+// ExpectedFile is the state a path should be in once every scenario line has run.
+type ExpectedFile struct {
+	Path       string
+	Exists     bool
+	Content    string
+	AnyContent bool // content unknown (e.g. moved from a path the scenario never wrote)
+	Scenario   string
+	LineNumber int
+	Origin     string // file:line and loop values, for rows expanded from a YAML/JSON template
+}
+
+// Discrepancy is a single difference between the expected and the actual tree.
+type Discrepancy struct {
+	Kind       string `json:"kind"` // "missing", "unexpected" or "mismatched"
+	Path       string `json:"path"`
+	Scenario   string `json:"scenario"`
+	LineNumber int    `json:"line"`
+	Origin     string `json:"origin,omitempty"`
+	Expected   string `json:"expected,omitempty"`
+	Actual     string `json:"actual,omitempty"`
+}
+
+func main() {
+	var scenarios scenarioList
+	repoPath := flag.String("repo", "", "Path to the local Git repository")
+	flag.Var(&scenarios, "scenario", "Path to a scenario CSV file (repeat to apply several in order)")
+	ref := flag.String("ref", "HEAD", "Commit, branch or tag to verify against (e.g. origin/main)")
+	fetch := flag.Bool("fetch", false, "Fetch origin before resolving --ref, to verify the remote head")
+	username := flag.String("username", "", "GitHub username (only needed with --fetch)")
+	token := flag.String("token", "", "GitHub personal access token (only needed with --fetch)")
+	reportPath := flag.String("report", "", "Path to write the JSON verification report (optional)")
+	repoName := flag.String("repo-name", "", "Name of this repository in the scenario's repo column; only its rows are checked (default: rows without a repo)")
+	flag.Parse()
+
+	if *repoPath == "" || len(scenarios) == 0 {
+		log.Fatal("Flags --repo and --scenario are required.")
+	}
+
+	expected := make(map[string]*ExpectedFile)
+	var deletedDirs []*ExpectedFile
+	for _, scenarioPath := range scenarios {
+		if err := applyScenario(scenarioPath, repositoryFilter{Path: *repoPath, Name: *repoName}, expected, &deletedDirs); err != nil {
+			log.Fatalf("Failed to read scenario %s: %v", scenarioPath, err)
+		}
+	}
+
+	repo, err := git.PlainOpen(*repoPath)
+	if err != nil {
+		log.Fatalf("Failed to open repository at %s: %v", *repoPath, err)
+	}
+
+	if *fetch {
+		fetchOptions := &git.FetchOptions{RemoteName: "origin"}
+		if *username != "" && *token != "" {
+			fetchOptions.Auth = &http.BasicAuth{Username: *username, Password: *token}
+		}
+		err = repo.Fetch(fetchOptions)
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			log.Fatalf("Failed to fetch origin: %v", err)
+		}
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(*ref))
+	if err != nil {
+		log.Fatalf("Failed to resolve %s: %v", *ref, err)
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		log.Fatalf("Failed to load commit %s: %v", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		log.Fatalf("Failed to load tree for %s: %v", hash, err)
+	}
+
+	discrepancies, err := compareTree(tree, expected, deletedDirs)
+	if err != nil {
+		log.Fatalf("Failed to compare tree: %v", err)
+	}
+
+	log.Printf("Verified %d path(s) against %s (%s)", len(expected), *ref, hash)
+	for _, d := range discrepancies {
+		where := fmt.Sprintf("%s line %d", d.Scenario, d.LineNumber)
+		if d.Origin != "" {
+			where = d.Origin
+		}
+		switch d.Kind {
+		case "mismatched":
+			log.Printf("MISMATCHED %s (%s): expected %q, got %q", d.Path, where, d.Expected, d.Actual)
+		default:
+			log.Printf("%s %s (%s)", strings.ToUpper(d.Kind), d.Path, where)
+		}
+	}
+
+	if *reportPath != "" {
+		report := map[string]interface{}{
+			"ref":           *ref,
+			"commit":        hash.String(),
+			"checked":       len(expected),
+			"discrepancies": discrepancies,
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*reportPath, data, 0644)
+		}
+		if err != nil {
+			log.Printf("Failed to write verification report: %v", err)
+		}
+	}
+
+	if len(discrepancies) > 0 {
+		log.Printf("Verification failed: %d discrepancy(ies)", len(discrepancies))
+		os.Exit(1)
+	}
+	log.Println("Repository state matches the scenario.")
+}
+
+// scenarioRow is one scenario operation with its content already resolved.
+type scenarioRow struct {
+	Line    int
+	Path    string
+	Op      string
+	Content string
+	Target  string
+	Origin  string
+	Repo    string
+}
+
+// repositoryFilter selects the rows of a multi-repository scenario that belong to the
+// verified repository. Rows without a repo value belong to the executor's --repo, so
+// they are checked only when no --repo-name is given.
+type repositoryFilter struct {
+	Path string
+	Name string
+}
+
+func (f repositoryFilter) matches(repo string) bool {
+	repo = strings.TrimSpace(repo)
+	if repo == "" {
+		return f.Name == ""
+	}
+	if repo == f.Name {
+		return true
+	}
+	a, errA := filepath.Abs(repo)
+	b, errB := filepath.Abs(f.Path)
+	return errA == nil && errB == nil && a == b
+}
+
+// applyScenario replays the scenario rows onto the expected state without touching git.
+func applyScenario(scenarioPath string, repo repositoryFilter, expected map[string]*ExpectedFile, deletedDirs *[]*ExpectedFile) error {
+	var rows []scenarioRow
+	var err error
+	if isScenarioDocument(scenarioPath) {
+		rows, err = documentRows(scenarioPath)
+	} else {
+		rows, err = csvRows(scenarioPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if !repo.matches(row.Repo) {
+			continue
+		}
+		lineNumber := row.Line
+		filePath := cleanScenarioPath(row.Path)
+		entry := &ExpectedFile{Path: filePath, Scenario: scenarioPath, LineNumber: lineNumber, Origin: row.Origin}
+
+		switch row.Op {
+		case "create", "update":
+			// The executor truncates the file, so it is empty unless content is given
+			entry.Exists = true
+			entry.Content = row.Content
+			expected[filePath] = entry
+		case "move":
+			if row.Target == "" {
+				return fmt.Errorf("move operation at line %d needs a target path", lineNumber)
+			}
+			targetPath := cleanScenarioPath(row.Target)
+			// A folder the scenario wrote files into moves with everything below it
+			var moved []*ExpectedFile
+			for p, file := range expected {
+				if file.Exists && strings.HasPrefix(p, filePath+"/") {
+					moved = append(moved, file)
+				}
+			}
+			if len(moved) > 0 {
+				for _, file := range moved {
+					expected[file.Path] = &ExpectedFile{Path: file.Path, Scenario: scenarioPath, LineNumber: lineNumber, Origin: row.Origin}
+					dst := targetPath + strings.TrimPrefix(file.Path, filePath)
+					expected[dst] = &ExpectedFile{Path: dst, Exists: true, Content: file.Content, AnyContent: file.AnyContent, Scenario: scenarioPath, LineNumber: lineNumber, Origin: row.Origin}
+				}
+				expected[filePath] = entry
+				*deletedDirs = append(*deletedDirs, entry)
+				continue
+			}
+			target := &ExpectedFile{Path: targetPath, Exists: true, AnyContent: true, Scenario: scenarioPath, LineNumber: lineNumber, Origin: row.Origin}
+			if source, known := expected[filePath]; known && source.Exists {
+				target.Content, target.AnyContent = source.Content, source.AnyContent
+			}
+			expected[filePath] = entry
+			expected[target.Path] = target
+		case "delete":
+			// A delete row may name a file or a folder; both must be gone afterwards
+			expected[filePath] = entry
+			for p := range expected {
+				if strings.HasPrefix(p, filePath+"/") {
+					expected[p] = &ExpectedFile{Path: p, Scenario: scenarioPath, LineNumber: lineNumber, Origin: row.Origin}
+				}
+			}
+			*deletedDirs = append(*deletedDirs, entry)
+		default:
+			return fmt.Errorf("invalid operation type '%s' at line %d", row.Op, lineNumber)
+		}
+	}
+	return nil
+}
+
+func documentRows(scenarioPath string) ([]scenarioRow, error) {
+	ops, err := readScenarioDocument(scenarioPath)
+	if err != nil {
+		return nil, err
+	}
+	var rows []scenarioRow
+	for _, op := range ops {
+		rows = append(rows, scenarioRow{Line: op.Line, Path: op.Path, Op: op.Op, Content: op.Content, Target: op.Target, Origin: op.Origin, Repo: op.Repo})
+	}
+	return rows, nil
+}
+
+// csvRows reads a CSV scenario the way the executor does: fields are trimmed, "@file:"
+// content is loaded and version 1 updates without content get the placeholder.
+func csvRows(scenarioPath string) ([]scenarioRow, error) {
+	f, err := os.Open(scenarioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []scenarioRow
+	var positions []int
+	headerChecked := false
+	version := 1
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("CSV parsing error: %v", err)
+		}
+		lineNumber, _ := reader.FieldPos(0)
+		if !headerChecked && len(rec) > 0 && strings.TrimSpace(strings.Join(rec, "")) != "" {
+			if version == 1 {
+				v, isMarker, err := parseFormatMarker(rec)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+				}
+				if isMarker {
+					version = v
+					continue
+				}
+			}
+			headerChecked = true
+			var isHeader bool
+			if positions, isHeader, err = parseHeader(rec); err != nil {
+				return nil, fmt.Errorf("invalid header at line %d: %v", lineNumber, err)
+			}
+			if isHeader {
+				continue
+			}
+			if version >= 2 {
+				return nil, fmt.Errorf("scenario format %d requires a header row at line %d", version, lineNumber)
+			}
+		}
+		if positions != nil {
+			rec = reorderRecord(rec, positions)
+		}
+		if len(rec) < 2 || strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+
+		row := scenarioRow{Line: lineNumber, Path: rec[0], Op: strings.TrimSpace(rec[1])}
+		if len(rec) > 3 {
+			if row.Content, err = scenarioContent(scenarioPath, rec[3]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+		}
+		if row.Op == "update" && (len(rec) < 4 || strings.TrimSpace(rec[3]) == "") && version < 2 {
+			row.Content = "test data"
+		}
+		if len(rec) > 5 {
+			row.Target = strings.TrimSpace(rec[5])
+		}
+		if len(rec) > 6 {
+			row.Repo = rec[6]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ScenarioDocument is the YAML/JSON form of a scenario. Operations map onto the CSV
+// columns; content is taken verbatim, so multi-line content needs no "@file:" reference.
+// Vars are defaults for "${name}" placeholders and can be overridden by an include.
+type ScenarioDocument struct {
+	Format     int                 `json:"format,omitempty" yaml:"format,omitempty"`
+	Vars       map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Operations []DocumentOperation `json:"operations" yaml:"operations"`
+}
+
+// DocumentOperation is one entry of a ScenarioDocument: an operation, an include of
+// another document, or a for loop over Do. Expansion leaves only operations.
+type DocumentOperation struct {
+	Path        string `json:"path,omitempty" yaml:"path,omitempty"`
+	Op          string `json:"op,omitempty" yaml:"op,omitempty"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+	Content     string `json:"content,omitempty" yaml:"content,omitempty"`
+	ContentFile string `json:"content_file,omitempty" yaml:"content_file,omitempty"` // relative to the scenario
+	Author      string `json:"author,omitempty" yaml:"author,omitempty"`
+	Target      string `json:"target,omitempty" yaml:"target,omitempty"`
+	Repo        string `json:"repo,omitempty" yaml:"repo,omitempty"` // repository name or path, for multi-repository runs
+	Time        string `json:"time,omitempty" yaml:"time,omitempty"` // RFC 3339 time of the operation, for time-scaled replay
+
+	Include string              `json:"include,omitempty" yaml:"include,omitempty"` // document to splice in, relative to this one
+	Vars    map[string]string   `json:"vars,omitempty" yaml:"vars,omitempty"`       // extra variables for the include or loop body
+	For     string              `json:"for,omitempty" yaml:"for,omitempty"`         // loop variable name
+	In      []string            `json:"in,omitempty" yaml:"in,omitempty"`           // values to loop over
+	Range   string              `json:"range,omitempty" yaml:"range,omitempty"`     // or an integer range "first..last"
+	Pad     int                 `json:"pad,omitempty" yaml:"pad,omitempty"`         // zero-pad range values to this width
+	Do      []DocumentOperation `json:"do,omitempty" yaml:"do,omitempty"`
+
+	Line   int    `json:"-" yaml:"-"`
+	Origin string `json:"-" yaml:"-"` // file:line and loop values the operation was expanded from
+}
+
+// placeholder matches "${name}", and "$${name}", which stands for a literal "${name}".
+var placeholder = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// isScenarioDocument reports whether the file extension selects the YAML or JSON format.
+func isScenarioDocument(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// readScenarioDocument loads a YAML or JSON scenario and expands its includes, loops and
+// variables. Each operation keeps the line it was written on and an Origin naming the
+// file and loop values, and content_file references are read into Content.
+func readScenarioDocument(filename string) ([]DocumentOperation, error) {
+	return expandDocument(filename, nil, "", nil)
+}
+
+func expandDocument(filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	for _, included := range stack {
+		if included == abs {
+			return nil, fmt.Errorf("include cycle: %s is already being expanded", filename)
+		}
+	}
+
+	doc, err := loadScenarioDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variables passed by an include win over the document's defaults
+	scope := make(map[string]string)
+	for name, value := range doc.Vars {
+		scope[name] = value
+	}
+	for name, value := range vars {
+		scope[name] = value
+	}
+	return expandItems(doc.Operations, filename, scope, bindings, append(stack, abs))
+}
+
+func expandItems(items []DocumentOperation, filename string, vars map[string]string, bindings string, stack []string) ([]DocumentOperation, error) {
+	var ops []DocumentOperation
+	for _, item := range items {
+		where := fmt.Sprintf("%s:%d", filename, item.Line)
+		scope, err := withVars(vars, item.Vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", where, err)
+		}
+
+		switch {
+		case item.Include != "" && item.For != "":
+			return nil, fmt.Errorf("%s: an entry cannot be both an include and a for loop", where)
+		case item.Include != "" || item.For != "":
+			if item.Path != "" || item.Op != "" {
+				return nil, fmt.Errorf("%s: include and for entries cannot also be operations", where)
+			}
+		}
+
+		switch {
+		case item.Include != "":
+			name, err := substitute(item.Include, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(filepath.Dir(filename), name)
+			}
+			included, err := expandDocument(name, scope, bindings, stack)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			ops = append(ops, included...)
+
+		case item.For != "":
+			values, err := loopValues(item, scope)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			for _, value := range values {
+				body := make(map[string]string, len(scope)+1)
+				for name, v := range scope {
+					body[name] = v
+				}
+				body[item.For] = value
+				expanded, err := expandItems(item.Do, filename, body, fmt.Sprintf("%s %s=%s", bindings, item.For, value), stack)
+				if err != nil {
+					return nil, err
+				}
+				ops = append(ops, expanded...)
+			}
+
+		default:
+			op, err := expandOperation(item, filename, scope, stack[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", where, err)
+			}
+			op.Origin = where
+			if bindings != "" {
+				op.Origin += " [" + strings.TrimSpace(bindings) + "]"
+			}
+			ops = append(ops, op)
+		}
+	}
+	return ops, nil
+}
+
+// expandOperation fills in the placeholders of one operation and loads its content_file.
+// The content_file reference is rewritten relative to the top-level document.
+func expandOperation(item DocumentOperation, filename string, vars map[string]string, topLevel string) (DocumentOperation, error) {
+	op := DocumentOperation{Line: item.Line}
+	fields := []struct {
+		from string
+		to   *string
+	}{
+		{item.Path, &op.Path}, {item.Op, &op.Op}, {item.Message, &op.Message}, {item.Content, &op.Content},
+		{item.ContentFile, &op.ContentFile}, {item.Author, &op.Author}, {item.Target, &op.Target}, {item.Repo, &op.Repo}, {item.Time, &op.Time},
+	}
+	for _, field := range fields {
+		value, err := substitute(field.from, vars)
+		if err != nil {
+			return op, err
+		}
+		*field.to = value
+	}
+
+	if op.Path == "" || op.Op == "" {
+		return op, fmt.Errorf("operation needs a path and an op")
+	}
+	if op.ContentFile == "" {
+		return op, nil
+	}
+	if op.Content != "" {
+		return op, fmt.Errorf("operation has both content and content_file")
+	}
+	contentPath := op.ContentFile
+	if !filepath.IsAbs(contentPath) {
+		contentPath = filepath.Join(filepath.Dir(filename), contentPath)
+		if abs, err := filepath.Abs(contentPath); err == nil {
+			if rel, err := filepath.Rel(filepath.Dir(topLevel), abs); err == nil {
+				op.ContentFile = filepath.ToSlash(rel)
+			}
+		}
+	}
+	content, err := os.ReadFile(contentPath)
+	if err != nil {
+		return op, fmt.Errorf("failed to read content_file: %v", err)
+	}
+	op.Content = string(content)
+	return op, nil
+}
+
+// withVars returns vars extended by extra, whose values may use the variables in vars.
+func withVars(vars, extra map[string]string) (map[string]string, error) {
+	if len(extra) == 0 {
+		return vars, nil
+	}
+	scope := make(map[string]string, len(vars)+len(extra))
+	for name, value := range vars {
+		scope[name] = value
+	}
+	for name, value := range extra {
+		expanded, err := substitute(value, vars)
+		if err != nil {
+			return nil, err
+		}
+		scope[name] = expanded
+	}
+	return scope, nil
+}
+
+// loopValues returns the values of a for loop: the "in" list, or the "range" first..last
+// zero-padded to "pad" digits.
+func loopValues(item DocumentOperation, vars map[string]string) ([]string, error) {
+	if (len(item.In) > 0) == (item.Range != "") {
+		return nil, fmt.Errorf("for %s needs exactly one of \"in\" and \"range\"", item.For)
+	}
+
+	var values []string
+	for _, v := range item.In {
+		value, err := substitute(v, vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	if item.Range == "" {
+		return values, nil
+	}
+
+	bounds, err := substitute(item.Range, vars)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(bounds, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("range must look like <first>..<last>, got %q", bounds)
+	}
+	first, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	last, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || last < first {
+		return nil, fmt.Errorf("invalid range %q", bounds)
+	}
+	for n := first; n <= last; n++ {
+		values = append(values, fmt.Sprintf("%0*d", item.Pad, n))
+	}
+	return values, nil
+}
+
+// substitute replaces "${name}" placeholders; an undefined variable is an error.
+// "$${name}" is kept as a literal "${name}".
+func substitute(s string, vars map[string]string) (string, error) {
+	var missing []string
+	result := placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined variable ${%s}", missing[0])
+	}
+	return result, nil
+}
+
+// loadScenarioDocument decodes one YAML or JSON file, rejecting unknown fields, and
+// records the line every entry starts on.
+func loadScenarioDocument(filename string) (ScenarioDocument, error) {
+	var doc ScenarioDocument
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return doc, err
+	}
+
+	isJSON := strings.ToLower(filepath.Ext(filename)) == ".json"
+	if isJSON {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid JSON scenario %s: %v", filename, err)
+		}
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&doc); err != nil {
+			return doc, fmt.Errorf("invalid YAML scenario %s: %v", filename, err)
+		}
+	}
+	if doc.Format != 0 && doc.Format != currentFormatVersion {
+		return doc, fmt.Errorf("unsupported scenario format %d in %s (YAML and JSON scenarios use format %d)", doc.Format, filename, currentFormatVersion)
+	}
+
+	// JSON is read through the YAML parser too, just for line numbers; if that fails
+	// (e.g. tab indentation) only top-level entries get exact lines
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err == nil && root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		assignLines(doc.Operations, mappingValue(root.Content[0], "operations"), 0)
+	} else if isJSON {
+		for i, line := range jsonOperationLines(data) {
+			if i < len(doc.Operations) {
+				assignLines(doc.Operations[i:i+1], nil, line)
+			}
+		}
+	}
+	return doc, nil
+}
+
+// assignLines copies the line of every sequence element onto items, recursing into
+// "do"; without a node the items inherit parentLine.
+func assignLines(items []DocumentOperation, seq *yaml.Node, parentLine int) {
+	for i := range items {
+		items[i].Line = parentLine
+		var node *yaml.Node
+		if seq != nil && seq.Kind == yaml.SequenceNode && i < len(seq.Content) {
+			node = seq.Content[i]
+			items[i].Line = node.Line
+		}
+		assignLines(items[i].Do, mappingValue(node, "do"), items[i].Line)
+	}
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// jsonOperationLines returns the line each element of the top-level "operations" array starts on.
+func jsonOperationLines(data []byte) []int {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		var skip json.RawMessage
+		if key != "operations" {
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+			continue
+		}
+		if tok, err := decoder.Token(); err != nil || tok != json.Delim('[') {
+			return nil
+		}
+		var lines []int
+		for decoder.More() {
+			// InputOffset is just past the previous token; skip to the element itself
+			offset := int(decoder.InputOffset())
+			for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+				offset++
+			}
+			lines = append(lines, 1+bytes.Count(data[:offset], []byte("\n")))
+			if decoder.Decode(&skip) != nil {
+				return nil
+			}
+		}
+		return lines
+	}
+	return nil
+}
+
+// currentFormatVersion is the scenario format written by the tools in this repository.
+// Version 1 is the original headerless layout; version 2 starts with a
+// "#scenario-format: 2" line followed by a header row, and an update without content
+// writes an empty file instead of the "test data" placeholder.
+const currentFormatVersion = 2
+
+const formatMarker = "#scenario-format:"
+
+// parseFormatMarker reports whether record is a "#scenario-format: N" line and returns N.
+func parseFormatMarker(record []string) (int, bool, error) {
+	if len(record) != 1 || !strings.HasPrefix(strings.TrimSpace(record[0]), formatMarker) {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(record[0]), formatMarker)))
+	if err != nil || version < 1 {
+		return 0, true, fmt.Errorf("invalid format marker %q", record[0])
+	}
+	if version > currentFormatVersion {
+		return version, true, fmt.Errorf("scenario format %d is newer than this tool supports (%d)", version, currentFormatVersion)
+	}
+	return version, true, nil
+}
+
+// scenarioColumns is the legacy positional layout. A header row may name these columns
+// in any order; files without one keep using the positions.
+var scenarioColumns = []string{"path", "op", "message", "content", "author", "target", "repo", "time"}
+
+// columnAliases are alternative header spellings.
+var columnAliases = map[string]string{
+	"operation":   "op",
+	"file":        "path",
+	"commit":      "message",
+	"target_path": "target",
+	"repository":  "repo",
+}
+
+// parseHeader reports whether record is a header row (it names both "path" and "op") and
+// returns, for every entry of scenarioColumns, the index it appears at or -1. Unknown
+// column names are an error so that a typo does not silently drop data; columns starting
+// with "x-" are free-form and ignored.
+func parseHeader(record []string) ([]int, bool, error) {
+	names := make([]string, len(record))
+	isHeader := map[string]bool{}
+	for i, field := range record {
+		name := strings.ToLower(strings.TrimSpace(field))
+		if alias, ok := columnAliases[name]; ok {
+			name = alias
+		}
+		names[i] = name
+		isHeader[name] = true
+	}
+	if !isHeader["path"] || !isHeader["op"] {
+		return nil, false, nil
+	}
+
+	positions := make([]int, len(scenarioColumns))
+	for i := range positions {
+		positions[i] = -1
+	}
+	for i, name := range names {
+		if strings.HasPrefix(name, "x-") {
+			continue
+		}
+		column := -1
+		for j, known := range scenarioColumns {
+			if name == known {
+				column = j
+			}
+		}
+		if column < 0 {
+			return nil, true, fmt.Errorf("unknown column %q in header (known: %s; prefix custom columns with x-)", record[i], strings.Join(scenarioColumns, ", "))
+		}
+		if positions[column] >= 0 {
+			return nil, true, fmt.Errorf("column %q appears more than once in header", name)
+		}
+		positions[column] = i
+	}
+	if positions[2] < 0 {
+		return nil, true, fmt.Errorf("header has no %q column", "message")
+	}
+	return positions, true, nil
+}
+
+// reorderRecord returns record in the legacy positional layout described by positions.
+func reorderRecord(record []string, positions []int) []string {
+	var reordered []string
+	for column, index := range positions {
+		if index < 0 || index >= len(record) {
+			continue
+		}
+		for len(reordered) < column {
+			reordered = append(reordered, "")
+		}
+		reordered = append(reordered, record[index])
+	}
+	return reordered
+}
+
+func compareTree(tree *object.Tree, expected map[string]*ExpectedFile, deletedDirs []*ExpectedFile) ([]Discrepancy, error) {
+	var discrepancies []Discrepancy
+
+	paths := make([]string, 0, len(expected))
+	for p := range expected {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		want := expected[p]
+		file, err := tree.File(p)
+		if err != nil && err != object.ErrFileNotFound {
+			return nil, fmt.Errorf("failed to look up %s: %v", p, err)
+		}
+
+		switch {
+		case want.Exists && file == nil && want.AnyContent && isTree(tree, p):
+			// moved from a folder the scenario never wrote into
+		case want.Exists && file == nil:
+			discrepancies = append(discrepancies, Discrepancy{Kind: "missing", Path: p, Scenario: want.Scenario, LineNumber: want.LineNumber, Origin: want.Origin})
+		case want.Exists && !want.AnyContent:
+			content, err := file.Contents()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", p, err)
+			}
+			if content != want.Content {
+				discrepancies = append(discrepancies, Discrepancy{
+					Kind: "mismatched", Path: p, Scenario: want.Scenario, LineNumber: want.LineNumber, Origin: want.Origin,
+					Expected: want.Content, Actual: content,
+				})
+			}
+		case file != nil:
+			discrepancies = append(discrepancies, Discrepancy{Kind: "unexpected", Path: p, Scenario: want.Scenario, LineNumber: want.LineNumber, Origin: want.Origin})
+		}
+	}
+
+	// Anything still below a deleted folder is unexpected, unless a later row recreated it
+	for _, dir := range deletedDirs {
+		subtree, err := tree.Tree(dir.Path)
+		if err != nil {
+			continue
+		}
+		err = subtree.Files().ForEach(func(f *object.File) error {
+			full := path.Join(dir.Path, f.Name)
+			if _, known := expected[full]; !known {
+				discrepancies = append(discrepancies, Discrepancy{Kind: "unexpected", Path: full, Scenario: dir.Scenario, LineNumber: dir.LineNumber, Origin: dir.Origin})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to walk %s: %v", dir.Path, err)
+		}
+	}
+
+	return discrepancies, nil
+}
+
+func isTree(tree *object.Tree, p string) bool {
+	_, err := tree.Tree(p)
+	return err == nil
+}
+
+// scenarioContent mirrors the executor: fields are trimmed and "@file:<path>" is read
+// relative to the scenario file.
+func scenarioContent(scenarioPath, field string) (string, error) {
+	field = strings.TrimSpace(field)
+	if !strings.HasPrefix(field, "@file:") {
+		return field, nil
+	}
+	contentPath := strings.TrimPrefix(field, "@file:")
+	if !filepath.IsAbs(contentPath) {
+		contentPath = filepath.Join(filepath.Dir(scenarioPath), contentPath)
+	}
+	data, err := os.ReadFile(contentPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read content reference: %v", err)
+	}
+	return string(data), nil
+}
+
+func cleanScenarioPath(p string) string {
+	return strings.TrimPrefix(path.Clean(strings.ReplaceAll(strings.TrimSpace(p), "\\", "/")), "./")
+}